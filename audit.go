@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+type auditConfig struct {
+	File       string
+	Syslog     bool
+	SyslogAddr string
+}
+
+type pdnsRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type pdnsComment struct {
+	Content    string `json:"content"`
+	Account    string `json:"account"`
+	ModifiedAt int64  `json:"modified_at,omitempty"`
+}
+
+type pdnsRRset struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	TTL        int           `json:"ttl,omitempty"`
+	ChangeType string        `json:"changetype,omitempty"`
+	Records    []pdnsRecord  `json:"records"`
+	Comments   []pdnsComment `json:"comments,omitempty"`
+}
+
+type auditEntry struct {
+	Time       time.Time   `json:"time"`
+	User       string      `json:"user"`
+	AuthSource string      `json:"auth_source,omitempty"`
+	RemoteAddr string      `json:"remote_addr"`
+	RequestID  string      `json:"request_id,omitempty"`
+	Backend    string      `json:"backend,omitempty"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Zone       string      `json:"zone,omitempty"`
+	Changes    []pdnsRRset `json:"changes,omitempty"`
+	Status     int         `json:"status"`
+}
+
+type auditFilter struct {
+	User   string
+	Zone   string
+	Method string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+type auditLog struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	syslog io.WriteCloser
+}
+
+func getAuditConfig() auditConfig {
+	return auditConfig{
+		File:       getEnv("AUDIT_LOG_FILE", ""),
+		Syslog:     getEnvBool("AUDIT_SYSLOG", false),
+		SyslogAddr: getEnv("AUDIT_SYSLOG_ADDR", ""),
+	}
+}
+
+func (c auditConfig) enabled() bool {
+	return c.File != "" || c.Syslog
+}
+
+func newAuditLog(cfg auditConfig) (*auditLog, error) {
+	a := &auditLog{path: cfg.File}
+
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open audit log: %w", err)
+		}
+		a.file = f
+	}
+
+	if cfg.Syslog {
+		w, err := newAuditSyslog(cfg.SyslogAddr)
+		if err != nil {
+			if a.file != nil {
+				a.file.Close()
+			}
+			return nil, fmt.Errorf("connect to syslog: %w", err)
+		}
+		a.syslog = w
+	}
+
+	return a, nil
+}
+
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var errs []error
+	if a.file != nil {
+		errs = append(errs, a.file.Close())
+	}
+	if a.syslog != nil {
+		errs = append(errs, a.syslog.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (a *auditLog) record(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("failed to encode audit entry: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file != nil {
+		if _, err := a.file.Write(append(line, '\n')); err != nil {
+			log.Printf("failed to write audit log: %v", err)
+		}
+	}
+	if a.syslog != nil {
+		if _, err := a.syslog.Write(line); err != nil {
+			log.Printf("failed to write audit entry to syslog: %v", err)
+		}
+	}
+}
+
+// query scans the audit file and returns the newest matching entries first.
+func (a *auditLog) query(filter auditFilter) ([]auditEntry, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if !filter.matches(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > filter.Limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+func (f auditFilter) matches(entry auditEntry) bool {
+	switch {
+	case f.User != "" && entry.User != f.User:
+		return false
+	case f.Zone != "" && entry.Zone != f.Zone:
+		return false
+	case f.Method != "" && entry.Method != f.Method:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && entry.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+func parseAuditFilter(query map[string][]string) (auditFilter, error) {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+		return ""
+	}
+
+	filter := auditFilter{
+		User:   get("user"),
+		Method: strings.ToUpper(get("method")),
+		Limit:  auditDefaultLimit,
+	}
+	if zone := get("zone"); zone != "" {
+		filter.Zone = canonicalZone(zone)
+	}
+
+	for key, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := get(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return auditFilter{}, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+		}
+		*target = t
+	}
+
+	if value := get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return auditFilter{}, errors.New("limit must be a positive integer")
+		}
+		filter.Limit = min(limit, auditMaxLimit)
+	}
+
+	return filter, nil
+}
+
+func handleAuditQuery(audit *auditLog, policy *accessPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if policy != nil {
+			id, _ := identityFromContext(r.Context())
+			if !policy.isAdmin(id) {
+				writeError(w, http.StatusForbidden, "only administrators may read the audit log")
+				return
+			}
+		}
+
+		if audit == nil || audit.path == "" {
+			writeError(w, http.StatusNotFound, "audit log file is not configured")
+			return
+		}
+
+		filter, err := parseAuditFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		entries, err := audit.query(filter)
+		if err != nil {
+			log.Printf("failed to read audit log: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to read audit log")
+			return
+		}
+		if entries == nil {
+			entries = []auditEntry{}
+		}
+
+		writeJSON(w, http.StatusOK, entries)
+	}
+}
+
+// rrsetChanges extracts the rrsets of a PowerDNS PATCH/PUT/POST body, if any.
+func rrsetChanges(body []byte) []pdnsRRset {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var payload struct {
+		RRsets []pdnsRRset `json:"rrsets"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+	return payload.RRsets
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
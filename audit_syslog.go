@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+	"strings"
+)
+
+// newAuditSyslog connects to the local syslog daemon, or to a remote one when
+// addr is given as "udp://host:514" or "tcp://host:514".
+func newAuditSyslog(addr string) (io.WriteCloser, error) {
+	network, raddr := "", ""
+	if addr != "" {
+		network, raddr, _ = strings.Cut(addr, "://")
+	}
+	return syslog.Dial(network, raddr, syslog.LOG_NOTICE|syslog.LOG_AUTHPRIV, "pdns-webui")
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func newAuditSyslog(addr string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
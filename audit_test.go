@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ─── auditLog.record / query ─────────────────────────────────────────────────
+
+func TestAuditLog_QueryFiltersNewestFirst(t *testing.T) {
+	audit := newTestAuditLog(t)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	audit.record(auditEntry{Time: base, User: "alice", Method: "PATCH", Zone: "example.com.", Status: 204})
+	audit.record(auditEntry{Time: base.Add(time.Minute), User: "bob", Method: "DELETE", Zone: "example.org.", Status: 204})
+	audit.record(auditEntry{Time: base.Add(2 * time.Minute), User: "alice", Method: "PATCH", Zone: "example.org.", Status: 422})
+
+	entries, err := audit.query(auditFilter{User: "alice", Limit: 10})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Status != 422 {
+		t.Errorf("entries not ordered newest first: %+v", entries)
+	}
+
+	entries, err = audit.query(auditFilter{Zone: "example.org.", Since: base.Add(30 * time.Second), Until: base.Add(90 * time.Second), Limit: 10})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 1 || entries[0].User != "bob" {
+		t.Errorf("time/zone filter returned %+v", entries)
+	}
+
+	entries, err = audit.query(auditFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status != 422 {
+		t.Errorf("limit returned %+v, want newest entry only", entries)
+	}
+}
+
+func TestParseAuditFilter_Invalid(t *testing.T) {
+	for _, query := range []string{"since=yesterday", "until=2026-13-01", "limit=0", "limit=abc"} {
+		t.Run(query, func(t *testing.T) {
+			values, _ := url.ParseQuery(query)
+			if _, err := parseAuditFilter(values); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestParseAuditFilter_CapsLimitAndCanonicalizesZone(t *testing.T) {
+	values, _ := url.ParseQuery("limit=999999&zone=Example.com&method=patch")
+
+	filter, err := parseAuditFilter(values)
+	if err != nil {
+		t.Fatalf("parseAuditFilter: %v", err)
+	}
+	if filter.Limit != auditMaxLimit {
+		t.Errorf("Limit = %d, want %d", filter.Limit, auditMaxLimit)
+	}
+	if filter.Zone != "example.com." || filter.Method != "PATCH" {
+		t.Errorf("filter = %+v", filter)
+	}
+}
+
+// ─── handlePDNSProxy с аудитом ───────────────────────────────────────────────
+
+func TestPDNSProxy_Audit_RecordsMutatingCall(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	audit := newTestAuditLog(t)
+	proxy := &pdnsProxy{client: newProxyClient(), audit: audit}
+
+	body := `{"rrsets":[{"name":"www.example.com.","type":"A","ttl":300,"changetype":"REPLACE","records":[{"content":"192.0.2.1","disabled":false}]}]}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.com.", strings.NewReader(body))
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "alice", Source: "local"}))
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := audit.query(auditFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.User != "alice" || entry.Method != http.MethodPatch || entry.Zone != "example.com." || entry.Status != http.StatusNoContent {
+		t.Errorf("entry = %+v", entry)
+	}
+	if len(entry.Changes) != 1 || entry.Changes[0].Name != "www.example.com." || entry.Changes[0].Records[0].Content != "192.0.2.1" {
+		t.Errorf("changes = %+v", entry.Changes)
+	}
+}
+
+func TestPDNSProxy_Audit_SkipsGET(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer backend.Close()
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	audit := newTestAuditLog(t)
+	proxy := &pdnsProxy{client: newProxyClient(), audit: audit}
+	proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/pdns/servers", nil))
+
+	entries, err := audit.query(auditFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("GET must not be audited, got %+v", entries)
+	}
+}
+
+func TestPDNSProxy_Audit_RecordsDeniedCall(t *testing.T) {
+	audit := newTestAuditLog(t)
+	proxy := &pdnsProxy{client: newProxyClient(), audit: audit, policy: &accessPolicy{}}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/pdns/servers/localhost/zones/example.com.", nil)
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "mallory"}))
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := audit.query(auditFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status != http.StatusForbidden || entries[0].User != "mallory" {
+		t.Errorf("entries = %+v, want one denied entry", entries)
+	}
+}
+
+// ─── handleAuditQuery ────────────────────────────────────────────────────────
+
+func TestHandleAuditQuery_ReturnsEntries(t *testing.T) {
+	audit := newTestAuditLog(t)
+	audit.record(auditEntry{Time: time.Now().UTC(), User: "alice", Method: "PATCH", Zone: "example.com.", Status: 204})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/audit?zone=example.com", nil)
+	w := httptest.NewRecorder()
+	handleAuditQuery(audit, nil)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var entries []auditEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if len(entries) != 1 || entries[0].User != "alice" {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+func TestHandleAuditQuery_NonAdminForbidden(t *testing.T) {
+	audit := newTestAuditLog(t)
+	policy := &accessPolicy{Grants: []accessGrant{
+		{Users: []string{"root"}, Role: roleAdmin},
+		{Users: []string{"zoneadmin"}, Role: roleAdmin, Zones: []string{"example.com."}},
+	}}
+
+	for user, want := range map[string]int{
+		"root":      http.StatusOK,
+		"zoneadmin": http.StatusForbidden,
+		"viewer":    http.StatusForbidden,
+	} {
+		t.Run(user, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+			req = req.WithContext(withIdentity(req.Context(), identity{User: user}))
+			w := httptest.NewRecorder()
+			handleAuditQuery(audit, policy)(w, req)
+
+			if w.Code != want {
+				t.Errorf("status = %d, want %d", w.Code, want)
+			}
+		})
+	}
+}
+
+func TestHandleAuditQuery_NotConfigured_Returns404(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	w := httptest.NewRecorder()
+	handleAuditQuery(nil, nil)(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleAuditQuery_BadFilter_Returns400(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/audit?since=yesterday", nil)
+	w := httptest.NewRecorder()
+	handleAuditQuery(newTestAuditLog(t), nil)(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func newTestAuditLog(t *testing.T) *auditLog {
+	t.Helper()
+	audit, err := newAuditLog(auditConfig{File: filepath.Join(t.TempDir(), "audit.jsonl")})
+	if err != nil {
+		t.Fatalf("newAuditLog: %v", err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	return audit
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const sessionCookieName = "pdns_webui_session"
+
+type authConfig struct {
+	UsersFile    string
+	PolicyFile   string
+	SessionTTL   time.Duration
+	CookieSecure bool
+}
+
+type identity struct {
+	User   string
+	Groups []string
+	Source string
+}
+
+type session struct {
+	identity identity
+	expires  time.Time
+}
+
+type authenticator struct {
+	cfg           authConfig
+	loginTemplate *template.Template
+	oidc          *oidcProvider
+	proxyAuth     proxyAuthConfig
+	clientCert    *clientCertConfig
+
+	mu       sync.Mutex
+	users    map[string][]byte
+	sessions map[string]session
+}
+
+type identityContextKey struct{}
+
+// dummyPasswordHash is compared against when the user does not exist so that
+// login timing does not reveal which usernames are valid.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("pdns-webui"), bcrypt.DefaultCost)
+
+func getAuthConfig() authConfig {
+	return authConfig{
+		UsersFile:    getEnv("AUTH_USERS_FILE", ""),
+		PolicyFile:   getEnv("AUTH_POLICY_FILE", ""),
+		SessionTTL:   getEnvDuration("AUTH_SESSION_TTL", 12*time.Hour),
+		CookieSecure: getEnvBool("AUTH_COOKIE_SECURE", false),
+	}
+}
+
+func newAuthenticator(cfg authConfig, loginTemplate *template.Template) (*authenticator, error) {
+	users := make(map[string][]byte)
+	if cfg.UsersFile != "" {
+		var err error
+		if users, err = loadUsersFile(cfg.UsersFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return &authenticator{
+		cfg:           cfg,
+		loginTemplate: loginTemplate,
+		users:         users,
+		sessions:      make(map[string]session),
+	}, nil
+}
+
+// loadUsersFile reads an htpasswd-style file with one "user:bcrypt-hash" entry
+// per line, as produced by `htpasswd -nbB user password`.
+func loadUsersFile(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open users file: %w", err)
+	}
+	defer f.Close()
+
+	users := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		user = strings.TrimSpace(user)
+		hash = strings.TrimSpace(hash)
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, lineNo)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s:%d: password for %q is not a bcrypt hash: %v", path, lineNo, user, err)
+		}
+		if _, exists := users[user]; exists {
+			return nil, fmt.Errorf("%s:%d: duplicate user %q", path, lineNo, user)
+		}
+		users[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read users file: %w", err)
+	}
+
+	return users, nil
+}
+
+func (a *authenticator) checkPassword(user, password string) bool {
+	a.mu.Lock()
+	hash, ok := a.users[user]
+	a.mu.Unlock()
+
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+func (a *authenticator) createSession(id identity) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, key)
+		}
+	}
+	a.sessions[token] = session{identity: id, expires: now.Add(a.cfg.SessionTTL)}
+
+	return token, nil
+}
+
+func (a *authenticator) lookupSession(token string) (identity, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.sessions[token]
+	if !ok {
+		return identity{}, false
+	}
+	if time.Now().After(s.expires) {
+		delete(a.sessions, token)
+		return identity{}, false
+	}
+	return s.identity, true
+}
+
+func (a *authenticator) deleteSession(token string) {
+	a.mu.Lock()
+	delete(a.sessions, token)
+	a.mu.Unlock()
+}
+
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if a.clientCert != nil {
+			if id, ok := a.clientCert.identityFromCertificate(r); ok {
+				next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+				return
+			}
+		}
+
+		if a.proxyAuth.enabled() {
+			if id, ok := a.proxyAuth.identityFromHeaders(r); ok {
+				next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+				return
+			}
+		}
+
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			if id, ok := a.lookupSession(cookie.Value); ok {
+				next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+				return
+			}
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") || !a.hasLoginPage() {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	})
+}
+
+func (a *authenticator) hasLoginPage() bool {
+	return a.cfg.UsersFile != "" || a.oidc != nil
+}
+
+func isPublicPath(path string) bool {
+	return path == "/login" || path == oidcLoginPath || path == oidcCallbackPath ||
+		path == "/healthz" || path == "/readyz" || path == "/metrics" ||
+		strings.HasPrefix(path, "/static/")
+}
+
+func (a *authenticator) handleLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.renderLogin(w, http.StatusOK, r.URL.Query().Get("next"), "")
+	case http.MethodPost:
+		user := strings.TrimSpace(r.PostFormValue("username"))
+		password := r.PostFormValue("password")
+		next := r.PostFormValue("next")
+
+		if user == "" || !a.checkPassword(user, password) {
+			log.Printf("failed login for %q from %s", user, r.RemoteAddr)
+			a.renderLogin(w, http.StatusUnauthorized, next, "Invalid username or password")
+			return
+		}
+
+		token, err := a.createSession(identity{User: user, Source: "local"})
+		if err != nil {
+			log.Printf("failed to create session: %v", err)
+			a.renderLogin(w, http.StatusInternalServerError, next, "Could not create session")
+			return
+		}
+
+		log.Printf("user %q logged in from %s", user, r.RemoteAddr)
+		a.setSessionCookie(w, r, token)
+		http.Redirect(w, r, safeRedirectTarget(next), http.StatusSeeOther)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *authenticator) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		a.deleteSession(cookie.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   a.cfg.CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (a *authenticator) setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(a.cfg.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   a.cfg.CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *authenticator) renderLogin(w http.ResponseWriter, status int, next, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := map[string]any{
+		"Next":       safeRedirectTarget(next),
+		"Error":      errorMessage,
+		"LocalLogin": a.cfg.UsersFile != "",
+		"OIDCLogin":  a.oidc != nil,
+	}
+	if err := a.loginTemplate.Execute(w, data); err != nil {
+		log.Printf("failed to render login template: %v", err)
+	}
+}
+
+// safeRedirectTarget only allows local absolute paths so that the login form
+// cannot be abused as an open redirect.
+func safeRedirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// requestUser returns the authenticated user name for log lines.
+func requestUser(r *http.Request) string {
+	if id, ok := identityFromContext(r.Context()); ok && id.User != "" {
+		return id.User
+	}
+	return "-"
+}
+
+func withIdentity(ctx context.Context, id identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+func identityFromContext(ctx context.Context) (identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(identity)
+	return id, ok
+}
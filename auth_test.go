@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ─── loadUsersFile ────────────────────────────────────────────────────────────
+
+func TestLoadUsersFile_ParsesHtpasswdEntries(t *testing.T) {
+	path := writeUsersFile(t, "# comment\n\nalice:"+mustBcrypt(t, "secret")+"\n")
+
+	users, err := loadUsersFile(path)
+	if err != nil {
+		t.Fatalf("loadUsersFile returned error: %v", err)
+	}
+	if _, ok := users["alice"]; !ok {
+		t.Fatal("user alice not loaded")
+	}
+}
+
+func TestLoadUsersFile_RejectsInvalidEntries(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing colon": "alice\n",
+		"plain text":    "alice:secret\n",
+		"empty user":    ":" + mustBcrypt(t, "secret") + "\n",
+		"duplicate":     "bob:" + mustBcrypt(t, "a") + "\nbob:" + mustBcrypt(t, "b") + "\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeUsersFile(t, content)
+			_, err := loadUsersFile(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), path+":") {
+				t.Errorf("error %q does not point at file and line", err)
+			}
+		})
+	}
+}
+
+func TestLoadUsersFile_MissingFile(t *testing.T) {
+	if _, err := loadUsersFile("/nonexistent/users"); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+// ─── authenticator.middleware ────────────────────────────────────────────────
+
+func TestAuthMiddleware_APIWithoutSession_Returns401(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers", nil)
+	w := httptest.NewRecorder()
+	auth.middleware(okHandler()).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body["detail"] == "" {
+		t.Error("detail field missing in error response")
+	}
+}
+
+func TestAuthMiddleware_PageWithoutSession_RedirectsToLogin(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/?view=zones", nil)
+	w := httptest.NewRecorder()
+	auth.middleware(okHandler()).ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	want := "/login?next=" + url.QueryEscape("/?view=zones")
+	if got := w.Header().Get("Location"); got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+}
+
+func TestAuthMiddleware_PublicPaths_PassThrough(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	for _, path := range []string{"/login", "/static/css/style.css"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			w := httptest.NewRecorder()
+			auth.middleware(okHandler()).ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_ValidSession_SetsIdentity(t *testing.T) {
+	auth := newTestAuthenticator(t)
+	token, err := auth.createSession(identity{User: "alice", Source: "local"})
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+
+	var got identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = identityFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w := httptest.NewRecorder()
+	auth.middleware(next).ServeHTTP(w, req)
+
+	if got.User != "alice" {
+		t.Errorf("identity user = %q, want %q", got.User, "alice")
+	}
+}
+
+func TestAuthMiddleware_ExpiredSession_Returns401(t *testing.T) {
+	auth := newTestAuthenticator(t)
+	auth.cfg.SessionTTL = -time.Minute
+	token, err := auth.createSession(identity{User: "alice"})
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w := httptest.NewRecorder()
+	auth.middleware(okHandler()).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+// ─── handleLogin / handleLogout ──────────────────────────────────────────────
+
+func TestHandleLogin_GET_RendersForm(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	w := httptest.NewRecorder()
+	auth.handleLogin(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Error("login form does not contain password field")
+	}
+}
+
+func TestHandleLogin_ValidCredentials_SetsCookieAndRedirects(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	w := postLogin(auth, "alice", "secret", "/?view=zones")
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if got := w.Header().Get("Location"); got != "/?view=zones" {
+		t.Errorf("Location = %q, want %q", got, "/?view=zones")
+	}
+
+	cookie := findCookie(w.Result().Cookies(), sessionCookieName)
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+	if !cookie.HttpOnly {
+		t.Error("session cookie must be HttpOnly")
+	}
+	if id, ok := auth.lookupSession(cookie.Value); !ok || id.User != "alice" {
+		t.Errorf("session lookup = %+v, %t", id, ok)
+	}
+}
+
+func TestHandleLogin_InvalidCredentials_Returns401(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	for name, creds := range map[string][2]string{
+		"wrong password": {"alice", "wrong"},
+		"unknown user":   {"mallory", "secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := postLogin(auth, creds[0], creds[1], "/")
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if findCookie(w.Result().Cookies(), sessionCookieName) != nil {
+				t.Error("session cookie must not be set on failed login")
+			}
+		})
+	}
+}
+
+func TestHandleLogin_RejectsOpenRedirect(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	for _, next := range []string{"https://evil.example", "//evil.example", "/\\evil.example"} {
+		t.Run(next, func(t *testing.T) {
+			w := postLogin(auth, "alice", "secret", next)
+
+			if got := w.Header().Get("Location"); got != "/" {
+				t.Errorf("Location = %q, want %q", got, "/")
+			}
+		})
+	}
+}
+
+func TestHandleLogout_DeletesSession(t *testing.T) {
+	auth := newTestAuthenticator(t)
+	token, err := auth.createSession(identity{User: "alice"})
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w := httptest.NewRecorder()
+	auth.handleLogout(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if _, ok := auth.lookupSession(token); ok {
+		t.Error("session still valid after logout")
+	}
+	if cookie := findCookie(w.Result().Cookies(), sessionCookieName); cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("session cookie not cleared: %+v", cookie)
+	}
+}
+
+func TestHandleLogout_GET_Returns405(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	w := httptest.NewRecorder()
+	auth.handleLogout(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// ─── handleAPIConfig с аутентификацией ───────────────────────────────────────
+
+func TestHandleAPIConfig_IncludesAuthenticatedUser(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "alice"}))
+	w := httptest.NewRecorder()
+	handleAPIConfig(nil, false)(w, req)
+
+	var body map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body["user"] != "alice" {
+		t.Errorf("user = %q, want %q", body["user"], "alice")
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+// newTestAuthenticator создаёт аутентификатор с пользователем alice/secret.
+func newTestAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+
+	path := writeUsersFile(t, "alice:"+mustBcrypt(t, "secret")+"\n")
+	tmpl, err := template.ParseFS(uiFS, "templates/login.html")
+	if err != nil {
+		t.Fatalf("parse login template: %v", err)
+	}
+
+	auth, err := newAuthenticator(authConfig{UsersFile: path, SessionTTL: time.Hour}, tmpl)
+	if err != nil {
+		t.Fatalf("newAuthenticator: %v", err)
+	}
+	return auth
+}
+
+func mustBcrypt(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	return string(hash)
+}
+
+func writeUsersFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write users file: %v", err)
+	}
+	return path
+}
+
+func postLogin(auth *authenticator, user, password, next string) *httptest.ResponseRecorder {
+	form := url.Values{"username": {user}, "password": {password}, "next": {next}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	auth.handleLogin(w, req)
+	return w
+}
+
+func okHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, c := range cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
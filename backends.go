@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultBackendName = "default"
+
+var backendNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+type backendsFile struct {
+	Backends []pdnsConfig `json:"backends"`
+}
+
+// loadBackends reads the named PowerDNS backends from a JSON file. The first
+// backend is the default for proxy paths without a backend segment.
+func loadBackends(path string) ([]pdnsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read backends file: %w", err)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+
+	var file backendsFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse backends file %s: %w", path, err)
+	}
+	if len(file.Backends) == 0 {
+		return nil, fmt.Errorf("backends file %s: no backends defined", path)
+	}
+
+	if err := validateBackends(file.Backends); err != nil {
+		return nil, fmt.Errorf("backends file %s: %w", path, err)
+	}
+
+	return file.Backends, nil
+}
+
+// validateBackends checks names, URLs and keys and fills in defaults.
+func validateBackends(backends []pdnsConfig) error {
+	seen := make(map[string]bool, len(backends))
+	for i := range backends {
+		backend := &backends[i]
+		switch {
+		case !backendNamePattern.MatchString(backend.Name):
+			return fmt.Errorf("backends[%d].name: invalid name %q", i, backend.Name)
+		case backend.Name == "servers":
+			// "servers" is the first segment of every PowerDNS API path.
+			return fmt.Errorf("backends[%d].name: %q is reserved", i, backend.Name)
+		case seen[backend.Name]:
+			return fmt.Errorf("backends[%d].name: duplicate name %q", i, backend.Name)
+		case strings.TrimSpace(backend.URL) == "":
+			return fmt.Errorf("backends[%d].url: required", i)
+		case backend.Key == "" && backend.KeyFile == "":
+			return fmt.Errorf("backends[%d].api_key: required unless api_key_file is set", i)
+		case backend.Key != "" && backend.KeyFile != "":
+			return fmt.Errorf("backends[%d]: api_key and api_key_file are mutually exclusive", i)
+		}
+		seen[backend.Name] = true
+
+		if backend.KeyFile != "" {
+			key, err := readSecretFile(backend.KeyFile)
+			if err != nil {
+				return fmt.Errorf("backends[%d].api_key_file: %w", i, err)
+			}
+			backend.Key = key
+		}
+
+		backend.URL = strings.TrimRight(strings.TrimSpace(backend.URL), "/")
+		if backend.ServerID == "" {
+			backend.ServerID = "localhost"
+		}
+	}
+
+	return nil
+}
+
+// backendSet holds the active backends. Reloads swap the whole list, so a
+// request keeps the backend it resolved even while the list changes.
+type backendSet struct {
+	list atomic.Pointer[[]pdnsConfig]
+}
+
+func newBackendSet(backends []pdnsConfig) *backendSet {
+	s := &backendSet{}
+	s.list.Store(&backends)
+	return s
+}
+
+// get falls back to the single backend configured through the PDNS_*
+// environment variables when no backends are set.
+func (s *backendSet) get() []pdnsConfig {
+	if s != nil {
+		if list := s.list.Load(); list != nil && len(*list) > 0 {
+			return *list
+		}
+	}
+	return []pdnsConfig{getPDNSConfig()}
+}
+
+func (s *backendSet) swap(backends []pdnsConfig) []pdnsConfig {
+	return *s.list.Swap(&backends)
+}
+
+func (s *backendSet) has(name string) bool {
+	return slices.ContainsFunc(s.get(), func(b pdnsConfig) bool { return b.Name == name })
+}
+
+// loadBackendConfig returns the backends from PDNS_BACKENDS_FILE, the config
+// file or the PDNS_* environment variables, in that order.
+func loadBackendConfig(fileCfg *fileConfig) ([]pdnsConfig, error) {
+	if backendsFile := getEnv("PDNS_BACKENDS_FILE", ""); backendsFile != "" {
+		return loadBackends(backendsFile)
+	}
+	if fileCfg != nil && len(fileCfg.Backends) > 0 {
+		return slices.Clone(fileCfg.Backends), nil
+	}
+	if _, err := getSecret("PDNS_API_KEY", ""); err != nil {
+		return nil, fmt.Errorf("read PDNS_API_KEY_FILE: %w", err)
+	}
+	return []pdnsConfig{getPDNSConfig()}, nil
+}
+
+// backendFor picks the backend named by the first segment of an escaped proxy
+// path and returns the remaining path. Paths without a backend segment go to
+// the default backend, so "servers/localhost/..." keeps working.
+func (p *pdnsProxy) backendFor(path string) (pdnsConfig, string) {
+	backends := p.backends.get()
+	if name, rest, ok := strings.Cut(path, "/"); ok {
+		for _, backend := range backends {
+			if backend.Name == name {
+				return backend, rest
+			}
+		}
+	}
+	return backends[0], path
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ─── loadBackends ────────────────────────────────────────────────────────────
+
+func TestLoadBackends_AppliesDefaults(t *testing.T) {
+	path := writeBackendsFile(t, `{"backends":[
+		{"name":"eu","url":"http://eu.example.com:8081/","api_key":"k1"},
+		{"name":"us","url":"http://us.example.com:8081","api_key":"k2","server_id":"us-1"}
+	]}`)
+
+	backends, err := loadBackends(path)
+	if err != nil {
+		t.Fatalf("loadBackends: %v", err)
+	}
+	if len(backends) != 2 {
+		t.Fatalf("got %d backends, want 2", len(backends))
+	}
+	if backends[0].URL != "http://eu.example.com:8081" || backends[0].ServerID != "localhost" {
+		t.Errorf("backends[0] = %+v", backends[0])
+	}
+	if backends[1].ServerID != "us-1" || backends[1].Key != "k2" {
+		t.Errorf("backends[1] = %+v", backends[1])
+	}
+}
+
+func TestLoadBackends_ReadsAPIKeyFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "eu.key")
+	if err := os.WriteFile(keyFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	backends, err := loadBackends(writeBackendsFile(t, `{"backends":[{"name":"eu","url":"http://eu","api_key_file":"`+keyFile+`"}]}`))
+	if err != nil {
+		t.Fatalf("loadBackends: %v", err)
+	}
+	if backends[0].Key != "from-file" {
+		t.Errorf("Key = %q, want %q", backends[0].Key, "from-file")
+	}
+}
+
+func TestLoadBackends_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":         `{"backends":[]}`,
+		"unknown field": `{"backends":[{"name":"eu","url":"http://eu","api_key":"k","zone":"x"}]}`,
+		"bad name":      `{"backends":[{"name":"eu/1","url":"http://eu","api_key":"k"}]}`,
+		"reserved name": `{"backends":[{"name":"servers","url":"http://eu","api_key":"k"}]}`,
+		"duplicate":     `{"backends":[{"name":"eu","url":"http://a","api_key":"k"},{"name":"eu","url":"http://b","api_key":"k"}]}`,
+		"missing url":   `{"backends":[{"name":"eu","api_key":"k"}]}`,
+		"missing key":   `{"backends":[{"name":"eu","url":"http://eu"}]}`,
+		"key and file":  `{"backends":[{"name":"eu","url":"http://eu","api_key":"k","api_key_file":"/k"}]}`,
+		"missing file":  `{"backends":[{"name":"eu","url":"http://eu","api_key_file":"/nonexistent/key"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadBackends(writeBackendsFile(t, content)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// ─── pdnsProxy с несколькими бэкендами ───────────────────────────────────────
+
+func TestPDNSProxy_Backends_RoutesByBackendSegment(t *testing.T) {
+	var gotEU, gotUS string
+	eu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEU = r.Header.Get("X-API-Key") + " " + r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer eu.Close()
+	us := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUS = r.Header.Get("X-API-Key") + " " + r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer us.Close()
+
+	proxy := &pdnsProxy{client: newProxyClient(), backends: newBackendSet([]pdnsConfig{
+		{Name: "eu", URL: eu.URL, Key: "eu-key", ServerID: "localhost"},
+		{Name: "us", URL: us.URL, Key: "us-key", ServerID: "localhost"},
+	})}
+
+	proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/pdns/us/servers/localhost/zones", nil))
+	if gotUS != "us-key /api/v1/servers/localhost/zones" || gotEU != "" {
+		t.Errorf("named backend: eu=%q us=%q", gotEU, gotUS)
+	}
+
+	proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost", nil))
+	if gotEU != "eu-key /api/v1/servers/localhost" {
+		t.Errorf("path without backend segment must use the first backend, got eu=%q", gotEU)
+	}
+}
+
+// ─── handleAPIConfig с несколькими бэкендами ─────────────────────────────────
+
+func TestHandleAPIConfig_ListsBackendsWithoutSecrets(t *testing.T) {
+	backends := []pdnsConfig{
+		{Name: "eu", URL: "http://eu", Key: "secret", ServerID: "eu-1"},
+		{Name: "us", URL: "http://us", Key: "secret", ServerID: "us-1"},
+	}
+
+	w := httptest.NewRecorder()
+	handleAPIConfig(newBackendSet(backends), false)(w, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+
+	var body struct {
+		ServerID string           `json:"server_id"`
+		Backends []map[string]any `json:"backends"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.ServerID != "eu-1" {
+		t.Errorf("server_id = %q, want default backend's %q", body.ServerID, "eu-1")
+	}
+	if len(body.Backends) != 2 || body.Backends[1]["name"] != "us" || body.Backends[1]["server_id"] != "us-1" {
+		t.Errorf("backends = %+v", body.Backends)
+	}
+	for _, backend := range body.Backends {
+		if _, ok := backend["api_key"]; ok {
+			t.Errorf("backend %q exposes its API key", backend["name"])
+		}
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func writeBackendsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "backends.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write backends file: %v", err)
+	}
+	return path
+}
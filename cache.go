@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTLs cache the zone list and statistics every page load asks
+// for. Zone exports have their own class and are never cached by default.
+var defaultCacheTTLs = map[string]time.Duration{
+	"zones":      5 * time.Second,
+	"statistics": 10 * time.Second,
+}
+
+// maxCachedBody keeps very large responses out of the cache; they are still
+// streamed to the client.
+const maxCachedBody = 16 << 20
+
+// defaultCacheMaxSize bounds the memory all cached bodies may use together.
+const defaultCacheMaxSize = 64 << 20
+
+// responseCache holds recent GET responses from PowerDNS per backend. Requests
+// are keyed by backend, path and query; authorization happens before the
+// cache, and PowerDNS answers the same for every caller since the proxy uses
+// one API key per backend.
+type responseCache struct {
+	// ttls is the lifetime of an entry per timeout class (see timeoutClass);
+	// classes without one are not cached.
+	ttls map[string]time.Duration
+	// maxSize is the total size of the cached bodies; the entries closest to
+	// expiry are evicted to stay below it.
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*cacheEntry
+	calls   map[string]*cacheCall
+	// generations count the invalidations per backend, so a fetch that raced
+	// with a change does not store the old state.
+	generations map[string]uint64
+}
+
+type cacheEntry struct {
+	backend     string
+	zone        string
+	contentType string
+	body        []byte
+	etag        string
+	expires     time.Time
+}
+
+// cacheCall is a fetch in flight; concurrent identical requests wait for it
+// instead of calling PowerDNS themselves. entry stays nil if the response
+// could not be cached, and the waiters then fetch on their own.
+type cacheCall struct {
+	done  chan struct{}
+	entry *cacheEntry
+}
+
+func getCacheTTLs() (map[string]time.Duration, error) {
+	ttls := maps.Clone(defaultCacheTTLs)
+	overrides, err := parseEndpointDurations(getEnv("PROXY_CACHE_TTL", ""))
+	if err != nil {
+		return nil, fmt.Errorf("PROXY_CACHE_TTL: %w", err)
+	}
+	maps.Copy(ttls, overrides)
+	maps.DeleteFunc(ttls, func(_ string, ttl time.Duration) bool { return ttl <= 0 })
+	return ttls, nil
+}
+
+// newResponseCache returns nil when no class has a TTL or maxSize is zero; a
+// nil cache passes every request through.
+func newResponseCache(ttls map[string]time.Duration, maxSize int64) *responseCache {
+	if len(ttls) == 0 || maxSize <= 0 {
+		return nil
+	}
+	return &responseCache{
+		ttls:        ttls,
+		maxSize:     maxSize,
+		entries:     make(map[string]*cacheEntry),
+		calls:       make(map[string]*cacheCall),
+		generations: make(map[string]uint64),
+	}
+}
+
+func (c *responseCache) ttl(class string) time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.ttls[class]
+}
+
+// entryLimit is the largest body that is buffered and cached.
+func (c *responseCache) entryLimit() int {
+	return int(min(maxCachedBody, c.maxSize))
+}
+
+// lookup returns a fresh entry, or joins or starts the fetch for key. The
+// caller that starts the fetch (leader) must call finish.
+func (c *responseCache) lookup(key string) (entry *cacheEntry, call *cacheCall, leader bool, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.entries[key]; entry != nil && time.Now().Before(entry.expires) {
+		return entry, nil, false, 0
+	}
+	if call := c.calls[key]; call != nil {
+		return nil, call, false, 0
+	}
+	call = &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	backend, _, _ := strings.Cut(key, "\x00")
+	return nil, call, true, c.generations[backend]
+}
+
+// finish publishes the leader's result to the waiting requests and stores it
+// unless the backend was changed in the meantime.
+func (c *responseCache) finish(key string, call *cacheCall, entry *cacheEntry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	call.entry = entry
+	close(call.done)
+
+	if entry == nil || c.generations[entry.backend] != generation {
+		return
+	}
+	c.remove(key)
+	now := time.Now()
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			c.remove(key)
+		}
+	}
+	for c.size+int64(len(entry.body)) > c.maxSize && len(c.entries) > 0 {
+		oldest := ""
+		for key, e := range c.entries {
+			if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+				oldest = key
+			}
+		}
+		c.remove(oldest)
+	}
+	c.entries[key] = entry
+	c.size += int64(len(entry.body))
+}
+
+// remove drops an entry; the caller holds c.mu.
+func (c *responseCache) remove(key string) {
+	if entry := c.entries[key]; entry != nil {
+		c.size -= int64(len(entry.body))
+		delete(c.entries, key)
+	}
+}
+
+// invalidate drops the entries a successful change to path may have made
+// stale: those of the same zone and the backend's zone-independent ones such
+// as the zone list, search results and statistics.
+func (c *responseCache) invalidate(backend, path string) {
+	if c == nil {
+		return
+	}
+	target, _ := parseProxyTarget(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[backend]++
+	for key, e := range c.entries {
+		if e.backend == backend && (e.zone == "" || e.zone == target.Zone) {
+			c.remove(key)
+		}
+	}
+	// Later requests must not join fetches that started before the change.
+	maps.DeleteFunc(c.calls, func(key string, _ *cacheCall) bool {
+		return strings.HasPrefix(key, backend+"\x00")
+	})
+}
+
+// forwardCached answers a GET from the cache, or forwards it and caches the
+// response for ttl.
+func (p *pdnsProxy) forwardCached(w http.ResponseWriter, r *http.Request, cfg pdnsConfig, path string, ttl time.Duration) {
+	key := cfg.Name + "\x00" + path + "?" + r.URL.RawQuery
+	logger := requestLogger(r).With("backend", cfg.Name, "method", r.Method, "path", path)
+
+	entry, call, leader, generation := p.cache.lookup(key)
+	if call != nil && !leader {
+		select {
+		case <-call.done:
+			entry = call.entry
+		case <-r.Context().Done():
+			return
+		}
+		if entry == nil {
+			p.forward(w, r, cfg, path, nil)
+			return
+		}
+	}
+	if entry != nil {
+		logger.Info("proxy request", "cache", "hit", "bytes", len(entry.body))
+		entry.write(w, r)
+		return
+	}
+
+	// The leader buffers the response so that it can be sent with its ETag;
+	// responses too large for the cache are streamed once they outgrow the
+	// buffer.
+	capture := &cacheWriter{ResponseWriter: w, limit: p.cache.entryLimit()}
+	var stored *cacheEntry
+	defer func() { p.cache.finish(key, call, stored, generation) }()
+
+	w.Header().Set("Cache-Control", "private, no-cache")
+	complete := p.forward(capture, r, cfg, path, nil)
+	if complete && capture.status == http.StatusOK && !capture.overflow {
+		target, _ := parseProxyTarget(path)
+		stored = newCacheEntry(cfg.Name, target.Zone, w.Header().Get("Content-Type"), capture.body.Bytes(), ttl)
+		stored.write(w, r)
+		return
+	}
+	capture.flush()
+}
+
+func newCacheEntry(backend, zone, contentType string, body []byte, ttl time.Duration) *cacheEntry {
+	sum := sha256.Sum256(body)
+	return &cacheEntry{
+		backend:     backend,
+		zone:        zone,
+		contentType: contentType,
+		body:        bytes.Clone(body),
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		expires:     time.Now().Add(ttl),
+	}
+}
+
+// write serves the entry, or 304 Not Modified when the browser already has it.
+func (e *cacheEntry) write(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", e.etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), e.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// etagMatches implements the weak comparison If-None-Match uses.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheWriter holds back the status and body of a response until flush, or
+// passes them through once the body grows past limit.
+type cacheWriter struct {
+	http.ResponseWriter
+	limit    int
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (c *cacheWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if c.overflow {
+		return c.ResponseWriter.Write(b)
+	}
+	if c.body.Len()+len(b) <= c.limit {
+		return c.body.Write(b)
+	}
+	c.flush()
+	c.overflow = true
+	return c.ResponseWriter.Write(b)
+}
+
+// flush sends what was held back; after an overflow it has nothing to do.
+func (c *cacheWriter) flush() {
+	if c.overflow || c.status == 0 {
+		return
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	c.ResponseWriter.Write(c.body.Bytes())
+	c.body.Reset()
+}
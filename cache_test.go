@@ -0,0 +1,297 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ─── getCacheTTLs ────────────────────────────────────────────────────────────
+
+func TestGetCacheTTLs_DefaultsAndOverrides(t *testing.T) {
+	t.Setenv("PROXY_CACHE_TTL", "statistics=0s, servers=1m")
+
+	ttls, err := getCacheTTLs()
+	if err != nil {
+		t.Fatalf("getCacheTTLs: %v", err)
+	}
+	cache := newResponseCache(ttls, defaultCacheMaxSize)
+	for class, want := range map[string]time.Duration{
+		"zones":      5 * time.Second,
+		"servers":    time.Minute,
+		"statistics": 0,
+		"export":     0,
+	} {
+		if got := cache.ttl(class); got != want {
+			t.Errorf("ttl(%q) = %s, want %s", class, got, want)
+		}
+	}
+}
+
+func TestNewResponseCache_DisabledWithoutTTLs(t *testing.T) {
+	t.Setenv("PROXY_CACHE_TTL", "zones=0s,statistics=0s")
+
+	ttls, err := getCacheTTLs()
+	if err != nil {
+		t.Fatalf("getCacheTTLs: %v", err)
+	}
+	if cache := newResponseCache(ttls, defaultCacheMaxSize); cache != nil {
+		t.Errorf("cache = %+v, want nil when every class is disabled", cache)
+	}
+}
+
+// ─── pdnsProxy cache ─────────────────────────────────────────────────────────
+
+func TestPDNSProxy_Cache_ServesHitsWithETag(t *testing.T) {
+	backend := newCacheTestBackend(t, 0)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+
+	first := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "")
+	if first.Code != http.StatusOK || first.Header().Get("Cache-Control") != "private, no-cache" || first.Header().Get("ETag") == "" {
+		t.Fatalf("first response = %d %v, want 200 with an ETag", first.Code, first.Header())
+	}
+
+	second := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "")
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Errorf("cached response = %d %q, want %q", second.Code, second.Body.String(), first.Body.String())
+	}
+	if got := backend.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want the second request served from the cache", got)
+	}
+	etag := second.Header().Get("ETag")
+	if etag != first.Header().Get("ETag") {
+		t.Fatalf("cached ETag = %q, want %q from the first response", etag, first.Header().Get("ETag"))
+	}
+
+	notModified := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", `W/"other", `+etag)
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("If-None-Match response = %d %q, want 304 without a body", notModified.Code, notModified.Body.String())
+	}
+
+	changed := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", `"other"`)
+	if changed.Code != http.StatusOK {
+		t.Errorf("non-matching If-None-Match status = %d, want 200", changed.Code)
+	}
+}
+
+func TestPDNSProxy_Cache_ExpiresAndSkipsUncachedClasses(t *testing.T) {
+	backend := newCacheTestBackend(t, 0)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+	proxy.cache.ttls["zones"] = 20 * time.Millisecond
+
+	cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "")
+	time.Sleep(30 * time.Millisecond)
+	cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "")
+	if got := backend.calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want the expired entry refetched", got)
+	}
+
+	for range 2 {
+		w := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/example.org./export", "")
+		if w.Header().Get("ETag") != "" {
+			t.Error("zone export carries an ETag, want exports not cached")
+		}
+	}
+	if got := backend.calls.Load(); got != 4 {
+		t.Errorf("upstream calls = %d, want every export sent to PowerDNS", got)
+	}
+}
+
+func TestPDNSProxy_Cache_MissAnswersIfNoneMatch(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeJSON(w, http.StatusOK, []any{})
+	}))
+	defer backend.Close()
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+	proxy.cache.ttls["zones"] = 20 * time.Millisecond
+
+	first := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "")
+	time.Sleep(30 * time.Millisecond)
+
+	refetched := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", first.Header().Get("ETag"))
+	if refetched.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304 for an unchanged response fetched after expiry", refetched.Code)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want the expired entry refetched", got)
+	}
+}
+
+func TestPDNSProxy_Cache_StaysWithinMaxSize(t *testing.T) {
+	backend := newCacheTestBackend(t, 0)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+	body := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/a.org.", "").Body.Len()
+	proxy.cache = newResponseCache(proxy.cache.ttls, int64(2*body+body/2))
+
+	for _, zone := range []string{"a.org.", "b.org.", "c.org."} {
+		cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/"+zone, "")
+		time.Sleep(time.Millisecond)
+	}
+	if proxy.cache.size > proxy.cache.maxSize || len(proxy.cache.entries) != 2 {
+		t.Errorf("cache holds %d entries of %d bytes, want 2 within %d", len(proxy.cache.entries), proxy.cache.size, proxy.cache.maxSize)
+	}
+
+	before := backend.calls.Load()
+	cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/a.org.", "")
+	cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/c.org.", "")
+	if got := backend.calls.Load() - before; got != 1 {
+		t.Errorf("upstream calls = %d, want only the evicted a.org. refetched", got)
+	}
+}
+
+func TestPDNSProxy_Cache_StreamsOversizedResponses(t *testing.T) {
+	backend := newCacheTestBackend(t, 0)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+	proxy.cache.maxSize = 10
+
+	for range 2 {
+		w := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"path"`) || w.Header().Get("ETag") != "" {
+			t.Errorf("response = %d %v %q, want the full body without an ETag", w.Code, w.Header(), w.Body.String())
+		}
+	}
+	if got := backend.calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want oversized responses not cached", got)
+	}
+}
+
+func TestPDNSProxy_Cache_DoesNotStoreErrors(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not Found"})
+	}))
+	defer backend.Close()
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+
+	for range 2 {
+		if w := cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/missing.org.", ""); w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want errors not cached", got)
+	}
+}
+
+func TestPDNSProxy_Cache_CoalescesConcurrentRequests(t *testing.T) {
+	backend := newCacheTestBackend(t, 50*time.Millisecond)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = cacheTestGet(proxy, "/api/pdns/servers/localhost/zones", "").Code
+		}()
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d status = %d, want 200", i, code)
+		}
+	}
+	if got := backend.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want concurrent requests coalesced into one", got)
+	}
+}
+
+func TestPDNSProxy_Cache_ChangeInvalidatesZone(t *testing.T) {
+	backend := newCacheTestBackend(t, 0)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+
+	for _, path := range []string{"zones", "zones/example.org.", "zones/other.org."} {
+		cacheTestGet(proxy, "/api/pdns/servers/localhost/"+path, "")
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{"rrsets":[]}`)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH status = %d, want 204", w.Code)
+	}
+
+	before := backend.calls.Load()
+	for _, path := range []string{"zones", "zones/example.org.", "zones/other.org."} {
+		cacheTestGet(proxy, "/api/pdns/servers/localhost/"+path, "")
+	}
+	if got := backend.calls.Load() - before; got != 2 {
+		t.Errorf("upstream calls after PATCH = %d, want the zone list and example.org. refetched and other.org. cached", got)
+	}
+}
+
+func TestPDNSProxy_Cache_FailedChangeKeepsEntries(t *testing.T) {
+	backend := newCacheTestBackend(t, 0)
+	proxy := newTestProxy(backend.URL)
+	proxy.cache = newTestCache()
+	cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/example.org.", "")
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/pdns/servers/localhost/zones/example.org.", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("DELETE status = %d, want 422", w.Code)
+	}
+
+	cacheTestGet(proxy, "/api/pdns/servers/localhost/zones/example.org.", "")
+	if got := backend.calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want the rejected DELETE not to invalidate", got)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+type cacheTestBackend struct {
+	*httptest.Server
+	calls atomic.Int32
+}
+
+// newCacheTestBackend counts every request. GETs answer after delay, PATCH
+// succeeds and DELETE is rejected.
+func newCacheTestBackend(t *testing.T, delay time.Duration) *cacheTestBackend {
+	backend := &cacheTestBackend{}
+	backend.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := backend.calls.Add(1)
+		switch r.Method {
+		case http.MethodPatch:
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "rejected"})
+		default:
+			time.Sleep(delay)
+			writeJSON(w, http.StatusOK, map[string]any{"path": r.URL.Path, "call": n})
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// newTestCache caches zones and statistics for a minute.
+func newTestCache() *responseCache {
+	return newResponseCache(map[string]time.Duration{"zones": time.Minute, "statistics": time.Minute}, defaultCacheMaxSize)
+}
+
+func cacheTestGet(proxy *pdnsProxy, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	return w
+}
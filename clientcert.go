@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// clientCertConfig maps verified TLS client certificates to identities.
+type clientCertConfig struct {
+	// UserField selects the certificate attribute used as the user name:
+	// "cn", "email", "dns" or "uri" (the latter three from the SAN).
+	UserField string
+}
+
+func getClientCertConfig() (clientCertConfig, error) {
+	cfg := clientCertConfig{UserField: strings.ToLower(getEnv("AUTH_CLIENT_CERT_USER", "cn"))}
+	if !validClientCertField(cfg.UserField) {
+		return clientCertConfig{}, fmt.Errorf("AUTH_CLIENT_CERT_USER: unsupported field %q, use cn, email, dns or uri", cfg.UserField)
+	}
+	return cfg, nil
+}
+
+func validClientCertField(field string) bool {
+	return field == "cn" || field == "email" || field == "dns" || field == "uri"
+}
+
+// identityFromCertificate returns the identity of a client certificate that
+// was verified against TLS_CLIENT_CA_FILE during the handshake. Groups are
+// taken from the subject's organizational units.
+func (c clientCertConfig) identityFromCertificate(r *http.Request) (identity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return identity{}, false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var user string
+	switch c.UserField {
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			user = cert.EmailAddresses[0]
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			user = cert.DNSNames[0]
+		}
+	case "uri":
+		if len(cert.URIs) > 0 {
+			user = cert.URIs[0].String()
+		}
+	default:
+		user = cert.Subject.CommonName
+	}
+	if user = strings.TrimSpace(user); user == "" {
+		return identity{}, false
+	}
+
+	return identity{User: user, Groups: cert.Subject.OrganizationalUnit, Source: "mtls"}, true
+}
+
+// parseClientAuth maps TLS_CLIENT_AUTH to the handshake policy. "optional"
+// lets clients without a certificate fall back to the other login methods.
+func parseClientAuth(value string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(value) {
+	case "", "require":
+		return tls.RequireAndVerifyClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unsupported client auth mode %q, use require or optional", value)
+	}
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("client CA file contains no PEM certificates")
+	}
+	return pool, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ─── getClientCertConfig ─────────────────────────────────────────────────────
+
+func TestGetClientCertConfig_InvalidField(t *testing.T) {
+	t.Setenv("AUTH_CLIENT_CERT_USER", "serial")
+
+	if _, err := getClientCertConfig(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// ─── clientCertConfig.identityFromCertificate ────────────────────────────────
+
+func TestClientCertConfig_IdentityFromCertificate(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/ops/alice")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "Alice", OrganizationalUnit: []string{"ops", "dns"}},
+		EmailAddresses: []string{"alice@example.com"},
+		DNSNames:       []string{"alice.ops.example.com"},
+		URIs:           []*url.URL{spiffe},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	for field, want := range map[string]string{
+		"cn":    "Alice",
+		"email": "alice@example.com",
+		"dns":   "alice.ops.example.com",
+		"uri":   "spiffe://example.com/ops/alice",
+	} {
+		id, ok := clientCertConfig{UserField: field}.identityFromCertificate(req)
+		if !ok || id.User != want || id.Source != "mtls" || len(id.Groups) != 2 {
+			t.Errorf("field %s: identity = %+v, %t; want user %q", field, id, ok, want)
+		}
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	if _, ok := (clientCertConfig{UserField: "cn"}).identityFromCertificate(req); ok {
+		t.Error("unverified connection must not yield an identity")
+	}
+}
+
+// ─── authenticator.middleware с клиентскими сертификатами ────────────────────
+
+func TestMTLS_VerifiedClientCertificateAuthenticates(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	server := newMTLSServer(t, ca, "require")
+
+	client := mtlsClient(server, ca.issue(t, "alice", "ops"))
+	resp, err := client.Get(server.URL + "/api/whoami")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var id identity
+	if err := json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || id.User != "alice" || id.Source != "mtls" || len(id.Groups) != 1 || id.Groups[0] != "ops" {
+		t.Errorf("status %d, identity %+v", resp.StatusCode, id)
+	}
+}
+
+func TestMTLS_RequiredRejectsMissingOrForeignCertificate(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	server := newMTLSServer(t, ca, "require")
+
+	if _, err := server.Client().Get(server.URL + "/api/whoami"); err == nil {
+		t.Error("handshake without client certificate must fail")
+	}
+
+	foreign := newTestCA(t, "Foreign CA")
+	if _, err := mtlsClient(server, foreign.issue(t, "mallory")).Get(server.URL + "/api/whoami"); err == nil {
+		t.Error("certificate from another CA must be rejected")
+	}
+}
+
+func TestMTLS_OptionalFallsBackToOtherMethods(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	server := newMTLSServer(t, ca, "optional")
+
+	resp, err := server.Client().Get(server.URL + "/api/whoami")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, units ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: units},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newMTLSServer starts a TLS server that trusts ca for client certificates and
+// answers /api/whoami with the authenticated identity.
+func newMTLSServer(t *testing.T, ca *testCA, clientAuth string) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	writeTestKeyPair(t, certFile, keyFile, "localhost")
+	writeFile(t, caFile, string(ca.pem))
+
+	tlsCfg, err := tlsConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: clientAuth}.serverConfig()
+	if err != nil {
+		t.Fatalf("serverConfig: %v", err)
+	}
+
+	auth, err := newAuthenticator(authConfig{SessionTTL: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("newAuthenticator: %v", err)
+	}
+	auth.clientCert = &clientCertConfig{UserField: "cn"}
+
+	server := httptest.NewUnstartedServer(auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := identityFromContext(r.Context())
+		writeJSON(w, http.StatusOK, id)
+	})))
+	// httptest installs its own server certificate; keep only our client CA policy.
+	server.TLS = &tls.Config{ClientAuth: tlsCfg.ClientAuth, ClientCAs: tlsCfg.ClientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func mtlsClient(server *httptest.Server, cert tls.Certificate) *http.Client {
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	client.Transport = transport
+	return client
+}
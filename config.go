@@ -0,0 +1,520 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the schema of the -config YAML file. Scalar settings are
+// exported as environment defaults, so real environment variables and flags
+// still take precedence.
+type fileConfig struct {
+	Listen struct {
+		Host string `yaml:"host"`
+		Port string `yaml:"port"`
+		// DrainDelay and ShutdownTimeout are Go durations.
+		DrainDelay      string `yaml:"drain_delay"`
+		ShutdownTimeout string `yaml:"shutdown_timeout"`
+		// ReadinessCacheTTL is how long /readyz reuses backend probe results.
+		ReadinessCacheTTL string `yaml:"readiness_cache_ttl"`
+	} `yaml:"listen"`
+
+	TLS struct {
+		CertFile     string   `yaml:"cert_file"`
+		KeyFile      string   `yaml:"key_file"`
+		MinVersion   string   `yaml:"min_version"`
+		CipherSuites []string `yaml:"cipher_suites"`
+		RedirectAddr string   `yaml:"redirect_addr"`
+		RedirectHost string   `yaml:"redirect_host"`
+		ClientCAFile string   `yaml:"client_ca_file"`
+		ClientAuth   string   `yaml:"client_auth"`
+	} `yaml:"tls"`
+
+	PDNS struct {
+		URL        string `yaml:"url"`
+		APIKey     string `yaml:"api_key"`
+		APIKeyFile string `yaml:"api_key_file"`
+		ServerID   string `yaml:"server_id"`
+		// StatsInterval enables re-exporting PowerDNS statistics on /metrics.
+		StatsInterval string `yaml:"stats_interval"`
+		// StatsRings also re-exports the rings of client addresses and
+		// queried names.
+		StatsRings bool `yaml:"stats_rings"`
+		// MaxRequestBody and MaxResponseBody are byte sizes such as 32MiB.
+		MaxRequestBody  string `yaml:"max_request_body"`
+		MaxResponseBody string `yaml:"max_response_body"`
+		// MaxRequestBodyEndpoints overrides max_request_body per endpoint
+		// class, e.g. {rrsets: 64MiB}.
+		MaxRequestBodyEndpoints map[string]string `yaml:"max_request_body_endpoints"`
+		// Retries and RetryBackoff control retries of failed GET requests;
+		// BreakerThreshold and BreakerCooldown the per-backend circuit
+		// breaker. Zero disables either.
+		Retries          *int   `yaml:"retries"`
+		RetryBackoff     string `yaml:"retry_backoff"`
+		BreakerThreshold *int   `yaml:"breaker_threshold"`
+		BreakerCooldown  string `yaml:"breaker_cooldown"`
+		// Timeouts are Go durations; Endpoints overrides response_header and
+		// total per endpoint class, e.g. {export: 30m}.
+		Timeouts struct {
+			Dial           string            `yaml:"dial"`
+			TLSHandshake   string            `yaml:"tls_handshake"`
+			ResponseHeader string            `yaml:"response_header"`
+			Total          string            `yaml:"total"`
+			Endpoints      map[string]string `yaml:"endpoints"`
+		} `yaml:"timeouts"`
+		// CacheTTL caches GET responses per endpoint class, e.g.
+		// {zones: 5s, statistics: 0s}; zero disables a class.
+		CacheTTL map[string]string `yaml:"cache_ttl"`
+		// CacheMaxSize bounds all cached responses together, e.g. 64MiB.
+		CacheMaxSize string `yaml:"cache_max_size"`
+	} `yaml:"pdns"`
+
+	Backends []pdnsConfig `yaml:"backends"`
+
+	// ReadOnly rejects every change to PowerDNS, like -read-only.
+	ReadOnly bool `yaml:"read_only"`
+
+	UpstreamTLS struct {
+		CAFile             string `yaml:"ca_file"`
+		CertFile           string `yaml:"cert_file"`
+		KeyFile            string `yaml:"key_file"`
+		ServerName         string `yaml:"server_name"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	} `yaml:"upstream_tls"`
+
+	Auth struct {
+		UsersFile      string `yaml:"users_file"`
+		PolicyFile     string `yaml:"policy_file"`
+		SessionTTL     string `yaml:"session_ttl"`
+		CookieSecure   bool   `yaml:"cookie_secure"`
+		ClientCertUser string `yaml:"client_cert_user"`
+
+		Proxy struct {
+			TrustedCIDRs []string `yaml:"trusted_cidrs"`
+			UserHeader   string   `yaml:"user_header"`
+			GroupsHeader string   `yaml:"groups_header"`
+		} `yaml:"proxy"`
+
+		OIDC struct {
+			IssuerURL        string            `yaml:"issuer_url"`
+			ClientID         string            `yaml:"client_id"`
+			ClientSecret     string            `yaml:"client_secret"`
+			ClientSecretFile string            `yaml:"client_secret_file"`
+			RedirectURL      string            `yaml:"redirect_url"`
+			Scopes           []string          `yaml:"scopes"`
+			UsernameClaim    string            `yaml:"username_claim"`
+			GroupsClaim      string            `yaml:"groups_claim"`
+			GroupMap         map[string]string `yaml:"group_map"`
+			AllowedGroups    []string          `yaml:"allowed_groups"`
+		} `yaml:"oidc"`
+	} `yaml:"auth"`
+
+	Policy *accessPolicy `yaml:"policy"`
+
+	Logging struct {
+		File            string `yaml:"file"`
+		Format          string `yaml:"format"`
+		AuditFile       string `yaml:"audit_file"`
+		AuditSyslog     bool   `yaml:"audit_syslog"`
+		AuditSyslogAddr string `yaml:"audit_syslog_addr"`
+		HistoryFile     string `yaml:"history_file"`
+	} `yaml:"logging"`
+}
+
+func loadConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	var cfg fileConfig
+	if len(root.Content) == 0 {
+		return &cfg, nil
+	}
+	if err := checkConfigKeys(&root, reflect.TypeFor[fileConfig](), ""); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	if err := root.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("config file %s: %s", path, strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n  "))
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// checkConfigKeys rejects mapping keys without a matching field in t and
+// names them by their dotted path, e.g. "auth.oidc.client_idd".
+func checkConfigKeys(node *yaml.Node, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := checkConfigKeys(child, t, path); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		if t.Kind() != reflect.Struct {
+			// Maps accept any key; type mismatches are reported by Decode.
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			keyPath := joinConfigKey(path, key.Value)
+			field, ok := yamlField(t, key.Value)
+			if !ok {
+				return fmt.Errorf("line %d: unknown key %s", key.Line, keyPath)
+			}
+			if err := checkConfigKeys(node.Content[i+1], field.Type, keyPath); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, item := range node.Content {
+			if err := checkConfigKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinConfigKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (c *fileConfig) validate() error {
+	if port := c.Listen.Port; port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("listen.port: %q is not a valid port", port)
+		}
+	}
+	if delay := c.Listen.DrainDelay; delay != "" {
+		if d, err := time.ParseDuration(delay); err != nil || d < 0 {
+			return fmt.Errorf("listen.drain_delay: %q is not a valid duration", delay)
+		}
+	}
+	if timeout := c.Listen.ShutdownTimeout; timeout != "" {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			return fmt.Errorf("listen.shutdown_timeout: %q is not a positive duration", timeout)
+		}
+	}
+	if format := c.Logging.Format; format != "" && format != "json" && format != "text" {
+		return fmt.Errorf("logging.format: unsupported format %q, use json or text", format)
+	}
+	for key, size := range map[string]string{"max_request_body": c.PDNS.MaxRequestBody, "max_response_body": c.PDNS.MaxResponseBody, "cache_max_size": c.PDNS.CacheMaxSize} {
+		if size == "" {
+			continue
+		}
+		if _, err := parseByteSize(size); err != nil {
+			return fmt.Errorf("pdns.%s: %w", key, err)
+		}
+	}
+	if _, err := parseEndpointLimits(c.endpointLimits()); err != nil {
+		return fmt.Errorf("pdns.max_request_body_endpoints: %w", err)
+	}
+	if _, err := parseEndpointDurations(c.endpointTimeouts()); err != nil {
+		return fmt.Errorf("pdns.timeouts.endpoints: %w", err)
+	}
+	if _, err := parseEndpointDurations(c.cacheTTLs()); err != nil {
+		return fmt.Errorf("pdns.cache_ttl: %w", err)
+	}
+	if interval := c.PDNS.StatsInterval; interval != "" {
+		if d, err := time.ParseDuration(interval); err != nil || d < 0 {
+			return fmt.Errorf("pdns.stats_interval: %q is not a valid duration", interval)
+		}
+	}
+	for key, n := range map[string]*int{"retries": c.PDNS.Retries, "breaker_threshold": c.PDNS.BreakerThreshold} {
+		if n != nil && *n < 0 {
+			return fmt.Errorf("pdns.%s: %d must not be negative", key, *n)
+		}
+	}
+	for key, value := range map[string]string{
+		"retry_backoff":            c.PDNS.RetryBackoff,
+		"breaker_cooldown":         c.PDNS.BreakerCooldown,
+		"timeouts.dial":            c.PDNS.Timeouts.Dial,
+		"timeouts.tls_handshake":   c.PDNS.Timeouts.TLSHandshake,
+		"timeouts.response_header": c.PDNS.Timeouts.ResponseHeader,
+		"timeouts.total":           c.PDNS.Timeouts.Total,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("pdns.%s: %q is not a valid duration", key, value)
+		}
+	}
+	if ttl := c.Listen.ReadinessCacheTTL; ttl != "" {
+		if d, err := time.ParseDuration(ttl); err != nil || d < 0 {
+			return fmt.Errorf("listen.readiness_cache_ttl: %q is not a valid duration", ttl)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+	if _, err := parseTLSVersion(c.TLS.MinVersion); err != nil {
+		return fmt.Errorf("tls.min_version: %w", err)
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return fmt.Errorf("tls.client_ca_file: requires cert_file and key_file")
+	}
+	if _, err := parseClientAuth(c.TLS.ClientAuth); err != nil {
+		return fmt.Errorf("tls.client_auth: %w", err)
+	}
+	if field := c.Auth.ClientCertUser; field != "" && !validClientCertField(field) {
+		return fmt.Errorf("auth.client_cert_user: unsupported field %q, use cn, email, dns or uri", field)
+	}
+	for i, name := range c.TLS.CipherSuites {
+		if _, err := parseCipherSuites([]string{name}); err != nil {
+			return fmt.Errorf("tls.cipher_suites[%d]: %w", i, err)
+		}
+	}
+
+	if c.PDNS.URL != "" {
+		if err := validateHTTPURL(c.PDNS.URL); err != nil {
+			return fmt.Errorf("pdns.url: %w", err)
+		}
+	}
+	if c.PDNS.APIKey != "" && c.PDNS.APIKeyFile != "" {
+		return fmt.Errorf("pdns: api_key and api_key_file are mutually exclusive")
+	}
+	if c.Auth.OIDC.ClientSecret != "" && c.Auth.OIDC.ClientSecretFile != "" {
+		return fmt.Errorf("auth.oidc: client_secret and client_secret_file are mutually exclusive")
+	}
+	if len(c.Backends) > 0 {
+		if c.PDNS.URL != "" || c.PDNS.APIKey != "" || c.PDNS.APIKeyFile != "" || c.PDNS.ServerID != "" {
+			return fmt.Errorf("pdns: cannot be combined with backends")
+		}
+		if err := validateBackends(c.Backends); err != nil {
+			return err
+		}
+		for i, backend := range c.Backends {
+			if err := validateHTTPURL(backend.URL); err != nil {
+				return fmt.Errorf("backends[%d].url: %w", i, err)
+			}
+		}
+	}
+
+	if (c.UpstreamTLS.CertFile == "") != (c.UpstreamTLS.KeyFile == "") {
+		return fmt.Errorf("upstream_tls: cert_file and key_file must be set together")
+	}
+
+	if ttl := c.Auth.SessionTTL; ttl != "" {
+		if d, err := time.ParseDuration(ttl); err != nil || d <= 0 {
+			return fmt.Errorf("auth.session_ttl: %q is not a positive duration", ttl)
+		}
+	}
+	for i, cidr := range c.Auth.Proxy.TrustedCIDRs {
+		if _, err := parseCIDRList(cidr); err != nil {
+			return fmt.Errorf("auth.proxy.trusted_cidrs[%d]: %w", i, err)
+		}
+	}
+	if issuer := c.Auth.OIDC.IssuerURL; issuer != "" {
+		if err := validateHTTPURL(issuer); err != nil {
+			return fmt.Errorf("auth.oidc.issuer_url: %w", err)
+		}
+		if c.Auth.OIDC.ClientID == "" {
+			return fmt.Errorf("auth.oidc.client_id: required when issuer_url is set")
+		}
+	}
+
+	if c.Policy != nil {
+		if c.Auth.PolicyFile != "" {
+			return fmt.Errorf("policy: cannot be combined with auth.policy_file")
+		}
+		if err := c.Policy.normalize(); err != nil {
+			return fmt.Errorf("policy.%w", err)
+		}
+	}
+
+	return nil
+}
+
+func validateHTTPURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http or https URL", value)
+	}
+	return nil
+}
+
+// endpointLimits renders pdns.max_request_body_endpoints in the format of
+// PROXY_MAX_REQUEST_BODY_ENDPOINTS.
+func (c *fileConfig) endpointLimits() string {
+	var items []string
+	for _, class := range slices.Sorted(maps.Keys(c.PDNS.MaxRequestBodyEndpoints)) {
+		items = append(items, class+"="+c.PDNS.MaxRequestBodyEndpoints[class])
+	}
+	return strings.Join(items, ",")
+}
+
+func (c *fileConfig) endpointTimeouts() string {
+	var items []string
+	for _, class := range slices.Sorted(maps.Keys(c.PDNS.Timeouts.Endpoints)) {
+		items = append(items, class+"="+c.PDNS.Timeouts.Endpoints[class])
+	}
+	return strings.Join(items, ",")
+}
+
+func (c *fileConfig) cacheTTLs() string {
+	var items []string
+	for _, class := range slices.Sorted(maps.Keys(c.PDNS.CacheTTL)) {
+		items = append(items, class+"="+c.PDNS.CacheTTL[class])
+	}
+	return strings.Join(items, ",")
+}
+
+// env maps the scalar settings to the environment variables read elsewhere.
+func (c *fileConfig) env() map[string]string {
+	vars := map[string]string{
+		"HOST":                             c.Listen.Host,
+		"PORT":                             c.Listen.Port,
+		"SHUTDOWN_DRAIN_DELAY":             c.Listen.DrainDelay,
+		"SHUTDOWN_TIMEOUT":                 c.Listen.ShutdownTimeout,
+		"READINESS_CACHE_TTL":              c.Listen.ReadinessCacheTTL,
+		"TLS_CERT_FILE":                    c.TLS.CertFile,
+		"TLS_KEY_FILE":                     c.TLS.KeyFile,
+		"TLS_MIN_VERSION":                  c.TLS.MinVersion,
+		"TLS_CIPHER_SUITES":                strings.Join(c.TLS.CipherSuites, ","),
+		"TLS_REDIRECT_ADDR":                c.TLS.RedirectAddr,
+		"TLS_REDIRECT_HOST":                c.TLS.RedirectHost,
+		"TLS_CLIENT_CA_FILE":               c.TLS.ClientCAFile,
+		"TLS_CLIENT_AUTH":                  c.TLS.ClientAuth,
+		"AUTH_CLIENT_CERT_USER":            c.Auth.ClientCertUser,
+		"PDNS_API_URL":                     c.PDNS.URL,
+		"PDNS_API_KEY":                     c.PDNS.APIKey,
+		"PDNS_API_KEY_FILE":                c.PDNS.APIKeyFile,
+		"PDNS_SERVER_ID":                   c.PDNS.ServerID,
+		"PDNS_STATS_INTERVAL":              c.PDNS.StatsInterval,
+		"PROXY_MAX_REQUEST_BODY":           c.PDNS.MaxRequestBody,
+		"PROXY_MAX_RESPONSE_BODY":          c.PDNS.MaxResponseBody,
+		"PROXY_MAX_REQUEST_BODY_ENDPOINTS": c.endpointLimits(),
+		"PROXY_RETRY_BACKOFF":              c.PDNS.RetryBackoff,
+		"PROXY_BREAKER_COOLDOWN":           c.PDNS.BreakerCooldown,
+		"PROXY_DIAL_TIMEOUT":               c.PDNS.Timeouts.Dial,
+		"PROXY_TLS_HANDSHAKE_TIMEOUT":      c.PDNS.Timeouts.TLSHandshake,
+		"PROXY_RESPONSE_HEADER_TIMEOUT":    c.PDNS.Timeouts.ResponseHeader,
+		"PROXY_TIMEOUT":                    c.PDNS.Timeouts.Total,
+		"PROXY_TIMEOUT_ENDPOINTS":          c.endpointTimeouts(),
+		"PROXY_CACHE_TTL":                  c.cacheTTLs(),
+		"PROXY_CACHE_MAX_SIZE":             c.PDNS.CacheMaxSize,
+		"PDNS_TLS_CA_FILE":                 c.UpstreamTLS.CAFile,
+		"PDNS_TLS_CERT_FILE":               c.UpstreamTLS.CertFile,
+		"PDNS_TLS_KEY_FILE":                c.UpstreamTLS.KeyFile,
+		"PDNS_TLS_SERVER_NAME":             c.UpstreamTLS.ServerName,
+		"AUTH_USERS_FILE":                  c.Auth.UsersFile,
+		"AUTH_POLICY_FILE":                 c.Auth.PolicyFile,
+		"AUTH_SESSION_TTL":                 c.Auth.SessionTTL,
+		"AUTH_PROXY_TRUSTED_CIDRS":         strings.Join(c.Auth.Proxy.TrustedCIDRs, ","),
+		"AUTH_PROXY_USER_HEADER":           c.Auth.Proxy.UserHeader,
+		"AUTH_PROXY_GROUPS_HEADER":         c.Auth.Proxy.GroupsHeader,
+		"OIDC_ISSUER_URL":                  c.Auth.OIDC.IssuerURL,
+		"OIDC_CLIENT_ID":                   c.Auth.OIDC.ClientID,
+		"OIDC_CLIENT_SECRET":               c.Auth.OIDC.ClientSecret,
+		"OIDC_CLIENT_SECRET_FILE":          c.Auth.OIDC.ClientSecretFile,
+		"OIDC_REDIRECT_URL":                c.Auth.OIDC.RedirectURL,
+		"OIDC_SCOPES":                      strings.Join(c.Auth.OIDC.Scopes, " "),
+		"OIDC_USERNAME_CLAIM":              c.Auth.OIDC.UsernameClaim,
+		"OIDC_GROUPS_CLAIM":                c.Auth.OIDC.GroupsClaim,
+		"OIDC_ALLOWED_GROUPS":              strings.Join(c.Auth.OIDC.AllowedGroups, ","),
+		"LOG_FILE":                         c.Logging.File,
+		"LOG_FORMAT":                       c.Logging.Format,
+		"AUDIT_LOG_FILE":                   c.Logging.AuditFile,
+		"AUDIT_SYSLOG_ADDR":                c.Logging.AuditSyslogAddr,
+		"HISTORY_FILE":                     c.Logging.HistoryFile,
+	}
+	if c.Auth.CookieSecure {
+		vars["AUTH_COOKIE_SECURE"] = "true"
+	}
+	if c.UpstreamTLS.InsecureSkipVerify {
+		vars["PDNS_TLS_INSECURE_SKIP_VERIFY"] = "true"
+	}
+	if c.Logging.AuditSyslog {
+		vars["AUDIT_SYSLOG"] = "true"
+	}
+	if c.ReadOnly {
+		vars["READ_ONLY"] = "true"
+	}
+	if c.PDNS.StatsRings {
+		vars["PDNS_STATS_RINGS"] = "true"
+	}
+	if c.PDNS.Retries != nil {
+		vars["PROXY_RETRIES"] = strconv.Itoa(*c.PDNS.Retries)
+	}
+	if c.PDNS.BreakerThreshold != nil {
+		vars["PROXY_BREAKER_THRESHOLD"] = strconv.Itoa(*c.PDNS.BreakerThreshold)
+	}
+
+	pairs := make([]string, 0, len(c.Auth.OIDC.GroupMap))
+	for from, to := range c.Auth.OIDC.GroupMap {
+		pairs = append(pairs, from+"="+to)
+	}
+	slices.Sort(pairs)
+	vars["OIDC_GROUP_MAP"] = strings.Join(pairs, ",")
+
+	return vars
+}
+
+// applyEnv sets every configured value whose environment variable is unset or
+// empty; getEnv treats empty variables as unset, so a blank entry copied from
+// .env.example does not hide the file's value.
+func (c *fileConfig) applyEnv() error {
+	for key, value := range c.env() {
+		if value == "" {
+			continue
+		}
+		if getEnv(key, "") != "" {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("set %s: %w", key, err)
+		}
+	}
+	return nil
+}
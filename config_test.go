@@ -0,0 +1,175 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ─── loadConfigFile ──────────────────────────────────────────────────────────
+
+func TestLoadConfigFile_Valid(t *testing.T) {
+	path := writeConfigFile(t, `
+listen:
+  host: 127.0.0.1
+  port: 9000
+read_only: true
+pdns:
+  retries: 0
+  breaker_cooldown: 1m
+  timeouts:
+    total: 2m
+    endpoints: {export: 30m, zones: 10s}
+  cache_ttl: {zones: 2s, statistics: 0s}
+  cache_max_size: 8MiB
+backends:
+  - name: eu
+    url: http://pdns-eu:8081/
+    api_key: secret
+    read_only: true
+auth:
+  session_ttl: 2h
+  oidc:
+    issuer_url: https://idp.example.com
+    client_id: webui
+    scopes: [openid, email]
+    group_map:
+      dns-admins: admins
+policy:
+  default_role: viewer
+  grants:
+    - users: [alice]
+      role: editor
+      zones: [Example.com]
+logging:
+  audit_file: /var/log/pdns-webui/audit.jsonl
+`)
+
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if cfg.Listen.Port != "9000" || cfg.Auth.SessionTTL != "2h" {
+		t.Errorf("listen/auth = %+v / %+v", cfg.Listen, cfg.Auth)
+	}
+	if len(cfg.Backends) != 1 || cfg.Backends[0].URL != "http://pdns-eu:8081" || cfg.Backends[0].ServerID != "localhost" || !cfg.Backends[0].ReadOnly {
+		t.Errorf("backends = %+v", cfg.Backends)
+	}
+	if cfg.Policy == nil || cfg.Policy.Grants[0].Zones[0] != "example.com." {
+		t.Errorf("policy = %+v, want normalized zones", cfg.Policy)
+	}
+
+	env := cfg.env()
+	if env["OIDC_SCOPES"] != "openid email" || env["OIDC_GROUP_MAP"] != "dns-admins=admins" || env["AUDIT_LOG_FILE"] != "/var/log/pdns-webui/audit.jsonl" || env["READ_ONLY"] != "true" ||
+		env["PROXY_RETRIES"] != "0" || env["PROXY_BREAKER_COOLDOWN"] != "1m" ||
+		env["PROXY_TIMEOUT"] != "2m" || env["PROXY_TIMEOUT_ENDPOINTS"] != "export=30m,zones=10s" ||
+		env["PROXY_CACHE_TTL"] != "statistics=0s,zones=2s" || env["PROXY_CACHE_MAX_SIZE"] != "8MiB" {
+		t.Errorf("env = %v", env)
+	}
+}
+
+func TestLoadConfigFile_EmptyFile(t *testing.T) {
+	if _, err := loadConfigFile(writeConfigFile(t, "")); err != nil {
+		t.Errorf("empty config file must be accepted, got %v", err)
+	}
+}
+
+func TestLoadConfigFile_ErrorsNameOffendingKey(t *testing.T) {
+	for name, tc := range map[string]struct{ content, want string }{
+		"unknown key":    {"auth:\n  oidc:\n    client_idd: x\n", "line 3: unknown key auth.oidc.client_idd"},
+		"unknown in seq": {"backends:\n  - name: eu\n    key: x\n", "unknown key backends[0].key"},
+		"wrong type":     {"logging:\n  audit_syslog: maybe\n", "line 2"},
+		"port":           {"listen:\n  port: 70000\n", "listen.port"},
+		"session ttl":    {"auth:\n  session_ttl: forever\n", "auth.session_ttl"},
+		"shutdown":       {"listen:\n  shutdown_timeout: 0s\n", "listen.shutdown_timeout"},
+		"tls pair":       {"tls:\n  cert_file: /etc/cert.pem\n", "tls: cert_file and key_file"},
+		"pdns url":       {"pdns:\n  url: pdns:8081\n", "pdns.url"},
+		"retries":        {"pdns:\n  retries: -1\n", "pdns.retries"},
+		"cooldown":       {"pdns:\n  breaker_cooldown: soon\n", "pdns.breaker_cooldown"},
+		"timeout":        {"pdns:\n  timeouts:\n    dial: soon\n", "pdns.timeouts.dial"},
+		"timeout class":  {"pdns:\n  timeouts:\n    endpoints: {exports: 1m}\n", "pdns.timeouts.endpoints"},
+		"cache ttl":      {"pdns:\n  cache_ttl: {zones: -1s}\n", "pdns.cache_ttl"},
+		"backend url":    {"backends:\n  - {name: eu, url: ftp://eu, api_key: k}\n", "backends[0].url"},
+		"pdns+backends":  {"pdns:\n  url: http://a\nbackends:\n  - {name: eu, url: http://eu, api_key: k}\n", "cannot be combined with backends"},
+		"cidr":           {"auth:\n  proxy:\n    trusted_cidrs: [10.0.0.0/8, nope]\n", "auth.proxy.trusted_cidrs[1]"},
+		"oidc client":    {"auth:\n  oidc:\n    issuer_url: https://idp\n", "auth.oidc.client_id"},
+		"policy role":    {"policy:\n  grants:\n    - {users: [a], role: owner}\n", "policy.grants[0].role"},
+		"syntax":         {"listen: [\n", "parse config file"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadConfigFile(writeConfigFile(t, tc.content))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %q, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// ─── parseListenConfig с -config ─────────────────────────────────────────────
+
+func TestParseListenConfig_ConfigFileLayering(t *testing.T) {
+	unsetEnv(t, "HOST", "PORT", "CONFIG_FILE", "PDNS_API_URL", "PDNS_API_KEY")
+	t.Setenv("PDNS_API_KEY", "from-env")
+
+	path := writeConfigFile(t, `
+listen:
+  host: 127.0.0.1
+  port: 9000
+pdns:
+  url: http://pdns-file:8081
+  api_key: from-file
+`)
+
+	cfg, err := parseListenConfig([]string{"-config", path, "-port", "9100"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseListenConfig: %v", err)
+	}
+	if cfg.Config == nil {
+		t.Fatal("Config not loaded")
+	}
+	if cfg.Host != "127.0.0.1" {
+		t.Errorf("Host = %q, want value from file", cfg.Host)
+	}
+	if cfg.Port != "9100" {
+		t.Errorf("Port = %q, flag must override file", cfg.Port)
+	}
+
+	pdnsCfg := getPDNSConfig()
+	if pdnsCfg.URL != "http://pdns-file:8081" || pdnsCfg.Key != "from-env" {
+		t.Errorf("pdns config = %+v, want URL from file and key from env", pdnsCfg)
+	}
+}
+
+func TestParseListenConfig_InvalidConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "listen:\n  hots: 127.0.0.1\n")
+
+	if _, err := parseListenConfig([]string{"-config", path}, io.Discard); err == nil || !strings.Contains(err.Error(), "listen.hots") {
+		t.Errorf("error = %v, want unknown key listen.hots", err)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pdns-webui.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
+
+// unsetEnv removes variables for the duration of the test and restores them
+// afterwards, so values applied from a config file do not leak.
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
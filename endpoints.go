@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// endpointPolicy restricts which PowerDNS API endpoints the proxy forwards.
+// It complements the zone grants: the proxy holds the admin API key, so
+// endpoints such as server configuration or key material must be blocked
+// before the upstream call.
+type endpointPolicy struct {
+	// AllowPrivateKeys exposes TSIG secrets and DNSSEC private keys, which are
+	// hidden by default.
+	AllowPrivateKeys bool           `json:"allow_private_keys" yaml:"allow_private_keys"`
+	Rules            []endpointRule `json:"rules" yaml:"rules"`
+}
+
+// endpointRule allows or denies paths for some roles and methods. Paths are
+// relative to servers/{id}/; "*" matches one segment and "**" any number of
+// segments. Rules are evaluated in order and the first match decides;
+// requests no rule matches are allowed.
+type endpointRule struct {
+	Allow   []string `json:"allow,omitempty" yaml:"allow"`
+	Deny    []string `json:"deny,omitempty" yaml:"deny"`
+	Roles   []role   `json:"roles,omitempty" yaml:"roles"`
+	Methods []string `json:"methods,omitempty" yaml:"methods"`
+}
+
+// defaultEndpointRules apply after the configured rules.
+var defaultEndpointRules = []endpointRule{
+	// Server settings and cache flushes affect every zone.
+	{Deny: []string{"config", "config/**", "cache/flush"}, Roles: []role{roleViewer, roleEditor}},
+}
+
+// privateKeyRules hide the single-key views that include secret material.
+var privateKeyRules = []endpointRule{
+	{Deny: []string{"tsigkeys/*", "zones/*/cryptokeys/*"}, Methods: []string{http.MethodGet}},
+}
+
+func (p *endpointPolicy) normalize() error {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if (len(rule.Allow) == 0) == (len(rule.Deny) == 0) {
+			return fmt.Errorf("endpoints.rules[%d]: exactly one of allow or deny is required", i)
+		}
+		for _, pattern := range slices.Concat(rule.Allow, rule.Deny) {
+			if strings.Trim(pattern, "/ ") == "" {
+				return fmt.Errorf("endpoints.rules[%d]: empty path pattern", i)
+			}
+		}
+		for j, r := range rule.Roles {
+			if !r.valid() {
+				return fmt.Errorf("endpoints.rules[%d].roles[%d]: unknown role %q", i, j, r)
+			}
+		}
+		for j, method := range rule.Methods {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if !allowedProxyMethods[method] {
+				return fmt.Errorf("endpoints.rules[%d].methods[%d]: unsupported method %q", i, j, method)
+			}
+			rule.Methods[j] = method
+		}
+	}
+	return nil
+}
+
+// authorize checks an escaped proxy path such as
+// "servers/localhost/tsigkeys/key1." for a caller with the given role.
+func (p *endpointPolicy) authorize(r role, method, escapedPath string) error {
+	segments := endpointSegments(escapedPath)
+
+	rules := slices.Concat(p.Rules, defaultEndpointRules)
+	if !p.AllowPrivateKeys {
+		rules = slices.Concat(privateKeyRules, rules)
+	}
+
+	for _, rule := range rules {
+		if len(rule.Roles) > 0 && !slices.Contains(rule.Roles, r) {
+			continue
+		}
+		if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+			continue
+		}
+		if slices.ContainsFunc(rule.Allow, func(pattern string) bool { return pathMatches(pattern, segments) }) {
+			return nil
+		}
+		if slices.ContainsFunc(rule.Deny, func(pattern string) bool { return pathMatches(pattern, segments) }) {
+			return fmt.Errorf("%s %s is blocked by the endpoint policy", method, strings.Join(segments, "/"))
+		}
+	}
+	return nil
+}
+
+// endpointSegments unescapes the path and strips the servers/{id} prefix.
+// Empty segments are dropped so "tsigkeys//key" cannot slip past a pattern.
+func endpointSegments(escapedPath string) []string {
+	var segments []string
+	for segment := range strings.SplitSeq(escapedPath, "/") {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) >= 2 && strings.EqualFold(segments[0], "servers") {
+		return segments[2:]
+	}
+	return segments
+}
+
+func pathMatches(pattern string, segments []string) bool {
+	return segmentsMatch(strings.FieldsFunc(pattern, func(r rune) bool { return r == '/' }), segments)
+}
+
+func segmentsMatch(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if segmentsMatch(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if pattern[0] != "*" && !strings.EqualFold(pattern[0], segments[0]) {
+		return false
+	}
+	return segmentsMatch(pattern[1:], segments[1:])
+}
+
+// role returns the strongest role the identity holds for the whole server;
+// the endpoint rules are keyed by role while zones are checked by the grants.
+// Like isAdmin, a grant limited to zones or methods does not lift the role
+// above viewer, so an admin of one zone stays subject to the viewer rules for
+// server-wide endpoints such as config.
+func (p *accessPolicy) role(id identity) role {
+	best := p.DefaultRole
+	for _, grant := range p.Grants {
+		if !grant.matches(id) {
+			continue
+		}
+		r := grant.Role
+		if len(grant.Zones) > 0 || len(grant.Methods) > 0 {
+			r = roleViewer
+		}
+		if roleRank(r) > roleRank(best) {
+			best = r
+		}
+	}
+	return best
+}
+
+func roleRank(r role) int {
+	return slices.Index([]role{roleViewer, roleEditor, roleAdmin}, r)
+}
+
+// authorizeEndpoint applies the endpoint rules of the access policy, or the
+// defaults when there is none. Without a policy every caller counts as admin,
+// matching the zone checks.
+func (p *pdnsProxy) authorizeEndpoint(r *http.Request, path string) error {
+	if p.policy == nil {
+		return (&endpointPolicy{}).authorize(roleAdmin, r.Method, path)
+	}
+	id, _ := identityFromContext(r.Context())
+	return p.policy.Endpoints.authorize(p.policy.role(id), r.Method, path)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ─── pathMatches ─────────────────────────────────────────────────────────────
+
+func TestPathMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"config", "servers/localhost/config", true},
+		{"config", "servers/localhost/config/allow-axfr-ips", false},
+		{"config/**", "servers/localhost/config/allow-axfr-ips", true},
+		{"zones/*/cryptokeys/*", "servers/localhost/zones/example.org./cryptokeys/3", true},
+		{"zones/*/cryptokeys/*", "servers/localhost/zones/example.org./cryptokeys", false},
+		{"zones/**", "servers/localhost/zones", true},
+		{"tsigkeys/*", "servers/localhost//tsigkeys//key1.", true},
+		{"tsigkeys/*", "servers/localhost/tsig%6Beys/key1.", true},
+		{"tsigkeys/*", "servers/localhost/TSIGKEYS/key1.", true},
+		{"**", "servers/localhost", true},
+	}
+	for _, tt := range tests {
+		if got := pathMatches(tt.pattern, endpointSegments(tt.path)); got != tt.want {
+			t.Errorf("pathMatches(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+// ─── endpointPolicy.authorize ────────────────────────────────────────────────
+
+func TestEndpointPolicy_HidesPrivateKeysByDefault(t *testing.T) {
+	policy := &endpointPolicy{Rules: []endpointRule{{Allow: []string{"**"}}}}
+	for _, path := range []string{"servers/localhost/tsigkeys/key1.", "servers/localhost/zones/example.org./cryptokeys/3"} {
+		if err := policy.authorize(roleAdmin, http.MethodGet, path); err == nil {
+			t.Errorf("GET %s allowed, want private keys hidden", path)
+		}
+	}
+	for _, path := range []string{"servers/localhost/tsigkeys", "servers/localhost/zones/example.org./cryptokeys"} {
+		if err := policy.authorize(roleAdmin, http.MethodGet, path); err != nil {
+			t.Errorf("GET %s: %v, want key listings allowed", path, err)
+		}
+	}
+
+	policy.AllowPrivateKeys = true
+	if err := policy.authorize(roleAdmin, http.MethodGet, "servers/localhost/tsigkeys/key1."); err != nil {
+		t.Errorf("allow_private_keys: %v", err)
+	}
+}
+
+func TestEndpointPolicy_DefaultRulesByRole(t *testing.T) {
+	policy := &endpointPolicy{}
+	if err := policy.authorize(roleEditor, http.MethodGet, "servers/localhost/config"); err == nil {
+		t.Error("editor may read server config")
+	}
+	if err := policy.authorize(roleViewer, http.MethodPut, "servers/localhost/cache/flush"); err == nil {
+		t.Error("viewer may flush the cache")
+	}
+	if err := policy.authorize(roleAdmin, http.MethodGet, "servers/localhost/config"); err != nil {
+		t.Errorf("admin config: %v", err)
+	}
+}
+
+func TestEndpointPolicy_Allowlist(t *testing.T) {
+	policy := &endpointPolicy{Rules: []endpointRule{
+		{Allow: []string{"zones", "zones/*", "search-data"}, Roles: []role{roleViewer}},
+		{Deny: []string{"**"}, Roles: []role{roleViewer}},
+		{Deny: []string{"autoprimaries/**"}, Methods: []string{http.MethodPost, http.MethodDelete}},
+	}}
+	tests := []struct {
+		role   role
+		method string
+		path   string
+		allow  bool
+	}{
+		{roleViewer, http.MethodGet, "servers/localhost/zones/example.org.", true},
+		{roleViewer, http.MethodGet, "servers/localhost/search-data", true},
+		{roleViewer, http.MethodGet, "servers/localhost/statistics", false},
+		{roleViewer, http.MethodGet, "servers/localhost/zones/example.org./metadata", false},
+		{roleAdmin, http.MethodGet, "servers/localhost/statistics", true},
+		{roleAdmin, http.MethodPost, "servers/localhost/autoprimaries", false},
+		{roleAdmin, http.MethodGet, "servers/localhost/autoprimaries", true},
+	}
+	for _, tt := range tests {
+		err := policy.authorize(tt.role, tt.method, tt.path)
+		if (err == nil) != tt.allow {
+			t.Errorf("%s %s %s: err = %v, want allowed = %t", tt.role, tt.method, tt.path, err, tt.allow)
+		}
+	}
+}
+
+func TestEndpointPolicy_Normalize(t *testing.T) {
+	invalid := map[string]endpointRule{
+		"both":    {Allow: []string{"zones"}, Deny: []string{"config"}},
+		"neither": {Roles: []role{roleViewer}},
+		"empty":   {Deny: []string{"/"}},
+		"role":    {Deny: []string{"config"}, Roles: []role{"owner"}},
+		"method":  {Deny: []string{"config"}, Methods: []string{"TRACE"}},
+	}
+	for name, rule := range invalid {
+		policy := &endpointPolicy{Rules: []endpointRule{rule}}
+		if err := policy.normalize(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	policy := &endpointPolicy{Rules: []endpointRule{{Deny: []string{"config"}, Methods: []string{"put"}}}}
+	if err := policy.normalize(); err != nil || policy.Rules[0].Methods[0] != http.MethodPut {
+		t.Errorf("normalize: %v, methods = %v", err, policy.Rules[0].Methods)
+	}
+}
+
+func TestAccessPolicy_Role(t *testing.T) {
+	policy := &accessPolicy{
+		DefaultRole: roleViewer,
+		Grants: []accessGrant{
+			{Users: []string{"alice"}, Role: roleEditor},
+			{Groups: []string{"ops"}, Role: roleAdmin},
+			{Users: []string{"zoe"}, Role: roleAdmin, Zones: []string{"example.com."}},
+			{Users: []string{"pat"}, Role: roleAdmin, Methods: []string{http.MethodPatch}},
+		},
+	}
+	tests := map[string]struct {
+		id   identity
+		want role
+	}{
+		"default":        {identity{User: "bob"}, roleViewer},
+		"grant":          {identity{User: "alice"}, roleEditor},
+		"group":          {identity{User: "alice", Groups: []string{"ops"}}, roleAdmin},
+		"zone-scoped":    {identity{User: "zoe"}, roleViewer},
+		"method-limited": {identity{User: "pat"}, roleViewer},
+	}
+	for name, tt := range tests {
+		if got := policy.role(tt.id); got != tt.want {
+			t.Errorf("%s: role = %q, want %q", name, got, tt.want)
+		}
+	}
+}
+
+// ─── pdnsProxy ───────────────────────────────────────────────────────────────
+
+func TestProxy_EndpointPolicyBlocksBeforeUpstream(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("blocked request reached PowerDNS: %s %s", r.Method, r.URL.Path)
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/tsigkeys/key1.", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "endpoint policy") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestProxy_ZoneScopedAdminCannotReadConfig(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("blocked request reached PowerDNS: %s %s", r.Method, r.URL.Path)
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	proxy.policy = &accessPolicy{Grants: []accessGrant{
+		{Users: []string{"zoe"}, Role: roleAdmin, Zones: []string{"example.com."}},
+	}}
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/config", nil)
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "zoe"}))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "endpoint policy") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestLoadAccessPolicy_EndpointRules(t *testing.T) {
+	path := writePolicyFile(t, `{
+		"default_role": "viewer",
+		"endpoints": {
+			"allow_private_keys": true,
+			"rules": [{"deny": ["statistics"], "roles": ["viewer"], "methods": ["get"]}]
+		}
+	}`)
+	policy, err := loadAccessPolicy(path)
+	if err != nil {
+		t.Fatalf("loadAccessPolicy: %v", err)
+	}
+	if !policy.Endpoints.AllowPrivateKeys || policy.Endpoints.Rules[0].Methods[0] != http.MethodGet {
+		t.Errorf("endpoints = %+v", policy.Endpoints)
+	}
+
+	if _, err := loadAccessPolicy(writePolicyFile(t, `{"endpoints": {"rules": [{"roles": ["viewer"]}]}}`)); err == nil {
+		t.Error("expected error for a rule without allow or deny")
+	}
+}
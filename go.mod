@@ -1,3 +1,8 @@
 module github.com/skrashevich/pdns-webui
 
-go 1.26
\ No newline at end of file
+go 1.26.0
+
+require (
+	golang.org/x/crypto v0.57.0
+	gopkg.in/yaml.v3 v3.0.1
+)
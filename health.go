@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const readinessProbeTimeout = 5 * time.Second
+
+// healthState backs the /healthz and /readyz endpoints. Readiness probes every
+// backend with GET servers/{id} and caches the outcome for ttl so frequent
+// probes do not load the PowerDNS API.
+type healthState struct {
+	draining atomic.Bool
+
+	client   *http.Client
+	backends *backendSet
+	breakers *circuitBreakers
+	ttl      time.Duration
+
+	mu         sync.Mutex
+	checkedAt  time.Time
+	results    []backendHealth
+	lastErrors map[string]*backendError
+}
+
+type backendHealth struct {
+	Name      string        `json:"name"`
+	Status    string        `json:"status"`
+	LatencyMS int64         `json:"latency_ms"`
+	Error     string        `json:"error,omitempty"`
+	LastError *backendError `json:"last_error,omitempty"`
+	// Circuit is the state of the backend's circuit breaker, if enabled.
+	Circuit circuitState `json:"circuit,omitempty"`
+}
+
+// backendError is the most recent failed probe of a backend; it is kept after
+// the backend recovers so flapping is visible.
+type backendError struct {
+	Time    time.Time `json:"time"`
+	Status  int       `json:"status"`
+	Message string    `json:"message,omitempty"`
+}
+
+type readiness struct {
+	Status    string          `json:"status"`
+	CheckedAt *time.Time      `json:"checked_at,omitempty"`
+	Backends  []backendHealth `json:"backends,omitempty"`
+}
+
+func newHealthState(client *http.Client, backends *backendSet, ttl time.Duration) *healthState {
+	return &healthState{client: client, backends: backends, ttl: ttl, lastErrors: make(map[string]*backendError)}
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady serves the public /readyz. Probe errors name backend URLs and
+// network details, so it reports only when and how each backend failed.
+func (h *healthState) handleReady(w http.ResponseWriter, r *http.Request) {
+	h.writeReadiness(w, r, false)
+}
+
+// handleReadyDetail serves /api/readyz, which is behind authentication and
+// includes the probe error messages.
+func (h *healthState) handleReadyDetail(w http.ResponseWriter, r *http.Request) {
+	h.writeReadiness(w, r, true)
+}
+
+func (h *healthState) writeReadiness(w http.ResponseWriter, r *http.Request, detail bool) {
+	if h.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readiness{Status: "draining"})
+		return
+	}
+	if h.backends == nil {
+		writeJSON(w, http.StatusOK, readiness{Status: "ok"})
+		return
+	}
+
+	checkedAt, results := h.check(r.Context())
+	status, state := http.StatusOK, "ok"
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, state = http.StatusServiceUnavailable, "unavailable"
+		}
+	}
+	if !detail {
+		results = withoutErrorMessages(results)
+	}
+	writeJSON(w, status, readiness{Status: state, CheckedAt: &checkedAt, Backends: results})
+}
+
+// withoutErrorMessages returns a copy of results without the probe errors.
+func withoutErrorMessages(results []backendHealth) []backendHealth {
+	public := make([]backendHealth, len(results))
+	for i, result := range results {
+		result.Error = ""
+		if result.LastError != nil {
+			result.LastError = &backendError{Time: result.LastError.Time, Status: result.LastError.Status}
+		}
+		public[i] = result
+	}
+	return public
+}
+
+// check returns the cached results or probes the backends again once they are
+// older than ttl. Concurrent callers wait for a single probe.
+func (h *healthState) check(ctx context.Context) (time.Time, []backendHealth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.results != nil && time.Since(h.checkedAt) < h.ttl {
+		return h.checkedAt, h.results
+	}
+
+	// The result is shared with every caller until it expires, so a client
+	// that disconnects early must not cut the probe short.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readinessProbeTimeout)
+	defer cancel()
+
+	backends := h.backends.get()
+	results := make([]backendHealth, len(backends))
+	statuses := make([]int, len(backends))
+	var wg sync.WaitGroup
+	for i, cfg := range backends {
+		wg.Go(func() {
+			start := time.Now()
+			status, message := h.probe(ctx, cfg)
+			results[i] = backendHealth{Name: cfg.Name, Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if status != 0 {
+				results[i].Status, results[i].Error = "error", message
+			}
+			statuses[i] = status
+		})
+	}
+	wg.Wait()
+
+	now := time.Now().UTC()
+	for i := range results {
+		if statuses[i] != 0 {
+			h.lastErrors[results[i].Name] = &backendError{Time: now, Status: statuses[i], Message: results[i].Error}
+		}
+		results[i].LastError = h.lastErrors[results[i].Name]
+		results[i].Circuit = h.breakers.get(results[i].Name).currentState()
+	}
+
+	h.checkedAt, h.results = now, results
+	return h.checkedAt, h.results
+}
+
+// probe requests the backend's server object and classifies failures like the
+// proxy does. A zero status means the backend is healthy. Probes go through
+// the circuit breaker, so they also serve as its half-open probes.
+func (h *healthState) probe(ctx context.Context, cfg pdnsConfig) (int, string) {
+	target := fmt.Sprintf("%s/api/v1/servers/%s", cfg.URL, url.PathEscape(cfg.ServerID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	req.Header.Set("X-API-Key", cfg.Key)
+	req.Header.Set("Accept", "application/json")
+
+	breaker := h.breakers.get(cfg.Name)
+	if err := breaker.allow(); err != nil {
+		return mapProxyError(err, cfg)
+	}
+	resp, err := h.client.Do(req)
+	breaker.record(err)
+	if err != nil {
+		return mapProxyError(err, cfg)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return http.StatusBadGateway, fmt.Sprintf("PowerDNS API returned %s", resp.Status)
+	}
+	return 0, ""
+}
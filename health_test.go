@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ─── health endpoints ────────────────────────────────────────────────────────
+
+func TestHandleReady_FailsWhileDraining(t *testing.T) {
+	health := &healthState{}
+
+	w := httptest.NewRecorder()
+	health.handleReady(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("ready status = %d, want 200", w.Code)
+	}
+
+	health.draining.Store(true)
+	w = httptest.NewRecorder()
+	health.handleReady(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("draining status = %d, want 503", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleHealth(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("healthz status = %d, want 200 while draining", w.Code)
+	}
+}
+
+func TestIsPublicPath_HealthEndpoints(t *testing.T) {
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		if !isPublicPath(path) {
+			t.Errorf("%s should be public", path)
+		}
+	}
+}
+
+// ─── readiness probes ────────────────────────────────────────────────────────
+
+func TestHandleReady_ProbesBackend(t *testing.T) {
+	var hits atomic.Int32
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/api/v1/servers/localhost" || r.Header.Get("X-API-Key") != "secret" {
+			t.Errorf("probe %s with key %q", r.URL.Path, r.Header.Get("X-API-Key"))
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": "localhost"})
+	}))
+	defer pdns.Close()
+
+	health := newHealthState(pdns.Client(), newBackendSet([]pdnsConfig{{Name: "main", URL: pdns.URL, Key: "secret", ServerID: "localhost"}}), time.Minute)
+	w, got := getReadiness(t, health.handleReady)
+	if w.Code != http.StatusOK || got.Status != "ok" {
+		t.Fatalf("status = %d %q, want 200 ok", w.Code, got.Status)
+	}
+	if len(got.Backends) != 1 || got.Backends[0].Name != "main" || got.Backends[0].Status != "ok" || got.Backends[0].LastError != nil {
+		t.Errorf("backends = %+v", got.Backends)
+	}
+
+	getReadiness(t, health.handleReady)
+	if n := hits.Load(); n != 1 {
+		t.Errorf("PowerDNS probed %d times, want 1 (cached)", n)
+	}
+}
+
+func TestHandleReady_CancelledCallerDoesNotFailProbe(t *testing.T) {
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		writeJSON(w, http.StatusOK, map[string]string{"id": "localhost"})
+	}))
+	defer pdns.Close()
+
+	health := newHealthState(pdns.Client(), newBackendSet([]pdnsConfig{{Name: "main", URL: pdns.URL, ServerID: "localhost"}}), time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	health.handleReady(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx))
+
+	w, got := getReadiness(t, health.handleReady)
+	if w.Code != http.StatusOK || got.Backends[0].LastError != nil {
+		t.Errorf("after a cancelled caller: %d %+v, want 200 without errors", w.Code, got.Backends[0])
+	}
+}
+
+func TestHandleReady_ReportsBackendErrors(t *testing.T) {
+	var healthy atomic.Bool
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": "localhost"})
+	}))
+	defer pdns.Close()
+
+	health := newHealthState(pdns.Client(), newBackendSet([]pdnsConfig{{Name: "main", URL: pdns.URL, ServerID: "localhost"}}), 0)
+	w, got := getReadiness(t, health.handleReadyDetail)
+	if w.Code != http.StatusServiceUnavailable || got.Status != "unavailable" {
+		t.Fatalf("status = %d %q, want 503 unavailable", w.Code, got.Status)
+	}
+	backend := got.Backends[0]
+	if backend.Status != "error" || backend.Error == "" || backend.LastError == nil || backend.LastError.Status != http.StatusBadGateway {
+		t.Errorf("backend = %+v", backend)
+	}
+
+	// The last error stays visible after the backend recovers.
+	healthy.Store(true)
+	w, got = getReadiness(t, health.handleReadyDetail)
+	if w.Code != http.StatusOK || got.Backends[0].Error != "" || got.Backends[0].LastError == nil {
+		t.Errorf("after recovery: %d %+v", w.Code, got.Backends[0])
+	}
+}
+
+func TestHandleReady_ConnectionRefused(t *testing.T) {
+	pdns := httptest.NewServer(http.NotFoundHandler())
+	addr := pdns.URL
+	pdns.Close()
+
+	health := newHealthState(http.DefaultClient, newBackendSet([]pdnsConfig{{Name: "main", URL: addr, ServerID: "localhost"}}), 0)
+	w, got := getReadiness(t, health.handleReady)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if last := got.Backends[0].LastError; last == nil || last.Status != http.StatusServiceUnavailable {
+		t.Errorf("last error = %+v, want 503 classification from mapProxyError", last)
+	}
+}
+
+func TestHandleReady_HidesErrorDetails(t *testing.T) {
+	pdns := httptest.NewServer(http.NotFoundHandler())
+	addr := pdns.URL
+	pdns.Close()
+
+	health := newHealthState(http.DefaultClient, newBackendSet([]pdnsConfig{{Name: "main", URL: addr, ServerID: "localhost"}}), time.Minute)
+	w, got := getReadiness(t, health.handleReady)
+	if strings.Contains(w.Body.String(), addr) || got.Backends[0].Error != "" || got.Backends[0].LastError.Message != "" {
+		t.Errorf("public /readyz = %s, want no error messages", w.Body.String())
+	}
+	if last := got.Backends[0].LastError; last.Status != http.StatusServiceUnavailable || last.Time.IsZero() {
+		t.Errorf("last error = %+v, want time and status kept", last)
+	}
+
+	w, got = getReadiness(t, health.handleReadyDetail)
+	if !strings.Contains(got.Backends[0].Error, addr) || !strings.Contains(got.Backends[0].LastError.Message, addr) {
+		t.Errorf("/api/readyz = %s, want the probe errors", w.Body.String())
+	}
+}
+
+func TestHandleReady_ReportsCircuitState(t *testing.T) {
+	pdns := httptest.NewServer(http.NotFoundHandler())
+	addr := pdns.URL
+	pdns.Close()
+
+	health := newHealthState(http.DefaultClient, newBackendSet([]pdnsConfig{{Name: "main", URL: addr, ServerID: "localhost"}}), 0)
+	health.breakers = newCircuitBreakers(breakerConfig{Threshold: 1, Cooldown: time.Minute})
+
+	_, got := getReadiness(t, health.handleReady)
+	if got.Backends[0].Circuit != circuitOpen {
+		t.Fatalf("circuit = %q after a refused connection, want open", got.Backends[0].Circuit)
+	}
+	w, got := getReadiness(t, health.handleReadyDetail)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(got.Backends[0].Error, "consecutive failures") {
+		t.Errorf("open circuit: %d %+v, want fast failure", w.Code, got.Backends[0])
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+func getReadiness(t *testing.T, handler http.HandlerFunc) (*httptest.ResponseRecorder, readiness) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var got readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode readiness: %v (%s)", err, w.Body.String())
+	}
+	return w, got
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const historyDefaultLimit = 50
+
+type historyEntry struct {
+	ID       string      `json:"id"`
+	Time     time.Time   `json:"time"`
+	User     string      `json:"user"`
+	Backend  string      `json:"backend,omitempty"`
+	ServerID string      `json:"server_id"`
+	ZoneID   string      `json:"zone_id"`
+	Zone     string      `json:"zone"`
+	Before   []pdnsRRset `json:"before"`
+	After    []pdnsRRset `json:"after"`
+	RevertOf string      `json:"revert_of,omitempty"`
+}
+
+type historyStore struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+type revertContextKey struct{}
+
+func newHistoryStore(path string) (*historyStore, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open history file: %w", err)
+	}
+	return &historyStore{path: path, file: f}, nil
+}
+
+func (h *historyStore) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+func (h *historyStore) append(entry historyEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.file.Write(append(line, '\n'))
+	return err
+}
+
+// list returns the newest entries for a zone first. An empty backend, zone or
+// id matches all entries.
+func (h *historyStore) list(backend, zone, id string, limit int) ([]historyEntry, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if (backend != "" && entry.Backend != backend) || (zone != "" && entry.Zone != zone) || (id != "" && entry.ID != id) {
+			continue
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+func (h *historyStore) get(zone, id string) (historyEntry, bool, error) {
+	entries, err := h.list("", zone, id, 1)
+	if err != nil || len(entries) == 0 {
+		return historyEntry{}, false, err
+	}
+	return entries[0], true, nil
+}
+
+// snapshotErrorBodyLimit bounds the PowerDNS error body passed through when a
+// snapshot is refused.
+const snapshotErrorBodyLimit = 64 << 10
+
+// snapshotStatusError is a snapshot GET that PowerDNS answered with an error
+// status. The status and body are passed to the client unchanged.
+type snapshotStatusError struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+func (e *snapshotStatusError) Error() string {
+	return fmt.Sprintf("PowerDNS returned %d: %s", e.status, strings.TrimSpace(string(e.body)))
+}
+
+// snapshotRRsets returns the current state of every rrset named in changes.
+// Rrsets that do not exist yet are returned with no records. When all changes
+// share a name, only that rrset is requested; PowerDNS versions without the
+// rrset_name filter return the whole zone, which is filtered here. Zones
+// larger than limit are refused.
+func snapshotRRsets(ctx context.Context, client *http.Client, cfg pdnsConfig, zonePath string, changes []pdnsRRset, limit int64) ([]pdnsRRset, error) {
+	target := fmt.Sprintf("%s/api/v1/%s", cfg.URL, zonePath)
+	if query := snapshotQuery(changes); query != "" {
+		target += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", cfg.Key)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, snapshotErrorBodyLimit))
+		return nil, &snapshotStatusError{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: body}
+	}
+
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		// Read one byte past the limit to detect oversized zones.
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, errResponseTooLarge
+	}
+
+	var zone struct {
+		RRsets []pdnsRRset `json:"rrsets"`
+	}
+	if err := json.Unmarshal(data, &zone); err != nil {
+		return nil, fmt.Errorf("decode zone: %w", err)
+	}
+
+	snapshot := make([]pdnsRRset, 0, len(changes))
+	for _, change := range changes {
+		current := pdnsRRset{Name: change.Name, Type: change.Type, Records: []pdnsRecord{}}
+		for _, rrset := range zone.RRsets {
+			if strings.EqualFold(rrset.Name, change.Name) && strings.EqualFold(rrset.Type, change.Type) {
+				current = rrset
+				current.ChangeType = ""
+				break
+			}
+		}
+		snapshot = append(snapshot, current)
+	}
+	return snapshot, nil
+}
+
+// snapshotQuery limits the zone GET to the rrsets of changes if they all have
+// the same name, and to their type if that is shared as well.
+func snapshotQuery(changes []pdnsRRset) string {
+	name, typ := changes[0].Name, changes[0].Type
+	for _, change := range changes[1:] {
+		if !strings.EqualFold(change.Name, name) {
+			return ""
+		}
+		if !strings.EqualFold(change.Type, typ) {
+			typ = ""
+		}
+	}
+	query := url.Values{"rrset_name": {name}}
+	if typ != "" {
+		query.Set("rrset_type", typ)
+	}
+	return query.Encode()
+}
+
+// writeSnapshotError answers a PATCH whose "before" snapshot failed. Error
+// responses from PowerDNS, such as a missing zone, are passed through as if
+// the PATCH had been forwarded.
+func writeSnapshotError(w http.ResponseWriter, err error, cfg pdnsConfig) {
+	var statusErr *snapshotStatusError
+	switch {
+	case errors.As(err, &statusErr):
+		if statusErr.contentType != "" {
+			w.Header().Set("Content-Type", statusErr.contentType)
+		}
+		w.WriteHeader(statusErr.status)
+		w.Write(statusErr.body)
+	case errors.Is(err, errResponseTooLarge):
+		writeError(w, http.StatusBadGateway, "failed to snapshot rrsets before change: zone exceeds the PROXY_MAX_RESPONSE_BODY limit")
+	default:
+		status, message := mapProxyError(err, cfg)
+		writeError(w, status, "failed to snapshot rrsets before change: "+message)
+	}
+}
+
+// inversePatch builds the rrset PATCH that restores the "before" snapshot.
+func inversePatch(entry historyEntry) []pdnsRRset {
+	rrsets := make([]pdnsRRset, 0, len(entry.Before))
+	for _, before := range entry.Before {
+		if len(before.Records) == 0 {
+			rrsets = append(rrsets, pdnsRRset{Name: before.Name, Type: before.Type, ChangeType: "DELETE", Records: []pdnsRecord{}})
+			continue
+		}
+
+		restored := before
+		restored.ChangeType = "REPLACE"
+		if restored.Comments == nil {
+			restored.Comments = []pdnsComment{}
+		}
+		rrsets = append(rrsets, restored)
+	}
+	return rrsets
+}
+
+// recordHistory snapshots the affected rrsets, forwards the PATCH via forward
+// and stores the before/after state when PowerDNS accepted it. Only a failed
+// "before" snapshot is returned; the change is not forwarded in that case.
+func (p *pdnsProxy) recordHistory(r *http.Request, cfg pdnsConfig, path string, target proxyTarget, changes []pdnsRRset, forward func() int) error {
+	ctx, cancel := p.timeouts.withTotalTimeout(r.Context(), "zones")
+	defer cancel()
+	before, err := snapshotRRsets(ctx, p.client, cfg, path, changes, p.limits.MaxResponseBody)
+	if err != nil {
+		return err
+	}
+
+	status := forward()
+	if status < 200 || status > 299 {
+		return nil
+	}
+
+	ctx, cancel = p.timeouts.withTotalTimeout(context.WithoutCancel(r.Context()), "zones")
+	defer cancel()
+	after, err := snapshotRRsets(ctx, p.client, cfg, path, changes, p.limits.MaxResponseBody)
+	if err != nil {
+		log.Printf("failed to snapshot rrsets after change in %s: %v", target.Zone, err)
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		log.Printf("failed to generate history id: %v", err)
+		return nil
+	}
+
+	entry := historyEntry{
+		ID:       id[:16],
+		Time:     time.Now().UTC(),
+		User:     requestUser(r),
+		Backend:  cfg.Name,
+		ServerID: target.ServerID,
+		ZoneID:   strings.Split(path, "/")[3],
+		Zone:     target.Zone,
+		Before:   before,
+		After:    after,
+	}
+	if revertOf, ok := r.Context().Value(revertContextKey{}).(string); ok {
+		entry.RevertOf = revertOf
+	}
+
+	if err := p.history.append(entry); err != nil {
+		log.Printf("failed to write history entry: %v", err)
+	}
+	return nil
+}
+
+func (p *pdnsProxy) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.history == nil {
+		writeError(w, http.StatusNotFound, "change history is not configured")
+		return
+	}
+
+	zone := canonicalZone(r.PathValue("zone"))
+	if p.policy != nil {
+		id, _ := identityFromContext(r.Context())
+		if err := p.policy.authorize(id, http.MethodGet, proxyTarget{Zone: zone}); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	limit := historyDefaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := p.history.list(r.URL.Query().Get("backend"), zone, "", limit)
+	if err != nil {
+		log.Printf("failed to read history: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read history")
+		return
+	}
+	if entries == nil {
+		entries = []historyEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleRevert replays the inverse PATCH through the proxy itself so that
+// authorization, auditing and history apply to the revert as well.
+func (p *pdnsProxy) handleRevert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.history == nil {
+		writeError(w, http.StatusNotFound, "change history is not configured")
+		return
+	}
+
+	zone := canonicalZone(r.PathValue("zone"))
+	entry, ok, err := p.history.get(zone, r.PathValue("id"))
+	if err != nil {
+		log.Printf("failed to read history: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read history")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "history entry not found")
+		return
+	}
+
+	body, err := json.Marshal(map[string]any{"rrsets": inversePatch(entry)})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Entries without a backend predate multiple backends and belong to the
+	// default one. A backend that was removed must not fall back to the
+	// default, which may be a different cluster.
+	target := "/api/pdns/servers/" + url.PathEscape(entry.ServerID) + "/zones/" + entry.ZoneID
+	if entry.Backend != "" {
+		if !p.backends.has(entry.Backend) {
+			writeError(w, http.StatusConflict, fmt.Sprintf("backend %q of this change is no longer configured", entry.Backend))
+			return
+		}
+		target = "/api/pdns/" + entry.Backend + "/servers/" + url.PathEscape(entry.ServerID) + "/zones/" + entry.ZoneID
+	}
+	ctx := context.WithValue(r.Context(), revertContextKey{}, entry.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, target, bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	req.RemoteAddr = r.RemoteAddr
+
+	log.Printf("%s reverting change %s in %s", requestUser(r), entry.ID, entry.Zone)
+	p.ServeHTTP(w, req)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ─── inversePatch ────────────────────────────────────────────────────────────
+
+func TestInversePatch_RestoresAndDeletes(t *testing.T) {
+	entry := historyEntry{Before: []pdnsRRset{
+		{Name: "www.example.com.", Type: "A", TTL: 300, Records: []pdnsRecord{{Content: "192.0.2.1"}}},
+		{Name: "new.example.com.", Type: "A", Records: []pdnsRecord{}},
+	}}
+
+	rrsets := inversePatch(entry)
+	if len(rrsets) != 2 {
+		t.Fatalf("got %d rrsets, want 2", len(rrsets))
+	}
+	if rrsets[0].ChangeType != "REPLACE" || rrsets[0].TTL != 300 || rrsets[0].Records[0].Content != "192.0.2.1" {
+		t.Errorf("restored rrset = %+v", rrsets[0])
+	}
+	if rrsets[1].ChangeType != "DELETE" || rrsets[1].Name != "new.example.com." {
+		t.Errorf("created rrset must be deleted, got %+v", rrsets[1])
+	}
+}
+
+// ─── pdnsProxy с историей ────────────────────────────────────────────────────
+
+func TestPDNSProxy_History_RecordsAndReverts(t *testing.T) {
+	backend := newFakeZoneBackend(t, pdnsRRset{Name: "www.example.com.", Type: "A", TTL: 300, Records: []pdnsRecord{{Content: "192.0.2.1"}}})
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	proxy := &pdnsProxy{client: newProxyClient(), history: newTestHistoryStore(t)}
+
+	body := `{"rrsets":[{"name":"www.example.com.","type":"A","ttl":60,"changetype":"REPLACE","records":[{"content":"192.0.2.99","disabled":false}]}]}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.com.", strings.NewReader(body))
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "alice"}))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	entries := getHistory(t, proxy, "example.com")
+	if len(entries) != 1 {
+		t.Fatalf("got %d history entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.User != "alice" || entry.ZoneID != "example.com." || entry.Before[0].Records[0].Content != "192.0.2.1" || entry.After[0].Records[0].Content != "192.0.2.99" {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/history/example.com./"+entry.ID+"/revert", nil)
+	req.SetPathValue("zone", "example.com.")
+	req.SetPathValue("id", entry.ID)
+	w = httptest.NewRecorder()
+	proxy.handleRevert(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revert status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body.String())
+	}
+
+	if got := backend.rrset("www.example.com.", "A"); got.TTL != 300 || got.Records[0].Content != "192.0.2.1" {
+		t.Errorf("rrset after revert = %+v", got)
+	}
+
+	entries = getHistory(t, proxy, "example.com.")
+	if len(entries) != 2 || entries[0].RevertOf != entry.ID {
+		t.Errorf("revert must be recorded as a new entry, got %+v", entries)
+	}
+}
+
+func TestPDNSProxy_History_SkipsRejectedPatch(t *testing.T) {
+	backend := newFakeZoneBackend(t)
+	backend.reject = true
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	proxy := &pdnsProxy{client: newProxyClient(), history: newTestHistoryStore(t)}
+
+	body := `{"rrsets":[{"name":"bad.example.com.","type":"A","changetype":"REPLACE","records":[{"content":"nope","disabled":false}]}]}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.com.", strings.NewReader(body))
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	if entries := getHistory(t, proxy, "example.com."); len(entries) != 0 {
+		t.Errorf("rejected PATCH must not be recorded, got %+v", entries)
+	}
+}
+
+func TestPDNSProxy_History_PassesThroughSnapshotErrors(t *testing.T) {
+	backend := newFakeZoneBackend(t)
+	backend.missing = true
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	proxy := &pdnsProxy{client: newProxyClient(), history: newTestHistoryStore(t)}
+
+	body := `{"rrsets":[{"name":"www.example.com.","type":"A","changetype":"DELETE","records":[]}]}`
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.com.", strings.NewReader(body)))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Could not find domain") {
+		t.Errorf("PATCH = %d %s, want the 404 from PowerDNS", w.Code, w.Body.String())
+	}
+}
+
+func TestSnapshotRRsets_RequestsOnlyChangedRRsets(t *testing.T) {
+	backend := newFakeZoneBackend(t, pdnsRRset{Name: "www.example.com.", Type: "A", Records: []pdnsRecord{{Content: "192.0.2.1"}}})
+	cfg := pdnsConfig{URL: backend.URL}
+	path := "servers/localhost/zones/example.com."
+
+	for _, changes := range [][]pdnsRRset{
+		{{Name: "www.example.com.", Type: "A"}},
+		{{Name: "www.example.com.", Type: "A"}, {Name: "www.example.com.", Type: "AAAA"}},
+		{{Name: "www.example.com.", Type: "A"}, {Name: "mail.example.com.", Type: "A"}},
+	} {
+		if _, err := snapshotRRsets(t.Context(), newProxyClient(), cfg, path, changes, 0); err != nil {
+			t.Fatalf("snapshotRRsets: %v", err)
+		}
+	}
+	want := []string{"rrset_name=www.example.com.&rrset_type=A", "rrset_name=www.example.com.", ""}
+	if !slices.Equal(backend.queries, want) {
+		t.Errorf("queries = %q, want %q", backend.queries, want)
+	}
+
+	if _, err := snapshotRRsets(t.Context(), newProxyClient(), cfg, path, []pdnsRRset{{Name: "www.example.com.", Type: "A"}}, 16); !errors.Is(err, errResponseTooLarge) {
+		t.Errorf("err = %v, want errResponseTooLarge for a zone over the limit", err)
+	}
+}
+
+func TestHandleRevert_UnknownEntry_Returns404(t *testing.T) {
+	proxy := &pdnsProxy{client: newProxyClient(), history: newTestHistoryStore(t)}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/history/example.com./missing/revert", nil)
+	req.SetPathValue("zone", "example.com.")
+	req.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+	proxy.handleRevert(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleRevert_RemovedBackend_Returns409(t *testing.T) {
+	called := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	proxy := &pdnsProxy{
+		client:   newProxyClient(),
+		history:  newTestHistoryStore(t),
+		backends: newBackendSet([]pdnsConfig{{Name: "eu", URL: backend.URL, ServerID: "localhost"}}),
+	}
+	entry := historyEntry{ID: "1", Backend: "us", ServerID: "localhost", ZoneID: "example.com.", Zone: "example.com."}
+	if err := proxy.history.append(entry); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/history/example.com./1/revert", nil)
+	req.SetPathValue("zone", "example.com.")
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+	proxy.handleRevert(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if called {
+		t.Error("revert of a removed backend must not reach another backend")
+	}
+}
+
+func TestHandleHistory_ForbiddenZone_Returns403(t *testing.T) {
+	policy := &accessPolicy{Grants: []accessGrant{{Users: []string{"alice"}, Role: roleViewer, Zones: []string{"example.org."}}}}
+	proxy := &pdnsProxy{client: newProxyClient(), history: newTestHistoryStore(t), policy: policy}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/history/example.com.", nil)
+	req.SetPathValue("zone", "example.com.")
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "alice"}))
+	w := httptest.NewRecorder()
+	proxy.handleHistory(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func newTestHistoryStore(t *testing.T) *historyStore {
+	t.Helper()
+	history, err := newHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("newHistoryStore: %v", err)
+	}
+	t.Cleanup(func() { history.Close() })
+	return history
+}
+
+func getHistory(t *testing.T, proxy *pdnsProxy, zone string) []historyEntry {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/history/"+zone, nil)
+	req.SetPathValue("zone", zone)
+	w := httptest.NewRecorder()
+	proxy.handleHistory(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var entries []historyEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	return entries
+}
+
+// fakeZoneBackend is a minimal PowerDNS zone endpoint that applies rrset PATCHes.
+type fakeZoneBackend struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	rrsets  []pdnsRRset
+	reject  bool
+	missing bool
+	queries []string
+}
+
+func newFakeZoneBackend(t *testing.T, rrsets ...pdnsRRset) *fakeZoneBackend {
+	t.Helper()
+	b := &fakeZoneBackend{rrsets: rrsets}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.serve))
+	t.Cleanup(b.Close)
+	return b
+}
+
+func (b *fakeZoneBackend) serve(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		b.queries = append(b.queries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		if b.missing {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Could not find domain 'example.com.'"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "example.com.", "rrsets": b.rrsets})
+	case http.MethodPatch:
+		if b.reject {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":"invalid record"}`))
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		for _, change := range rrsetChanges(data) {
+			kept := b.rrsets[:0]
+			for _, rrset := range b.rrsets {
+				if rrset.Name != change.Name || rrset.Type != change.Type {
+					kept = append(kept, rrset)
+				}
+			}
+			b.rrsets = kept
+			if change.ChangeType == "REPLACE" {
+				change.ChangeType = ""
+				b.rrsets = append(b.rrsets, change)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (b *fakeZoneBackend) rrset(name, typ string) pdnsRRset {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, rrset := range b.rrsets {
+		if rrset.Name == name && rrset.Type == typ {
+			return rrset
+		}
+	}
+	return pdnsRRset{}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultEndpointBodyLimits keep requests to endpoints that only take small
+// documents well below PROXY_MAX_REQUEST_BODY, which sizes bulk rrset
+// changes and zone creation.
+var defaultEndpointBodyLimits = map[string]int64{
+	"servers":    1 << 20,
+	"search":     1 << 20,
+	"statistics": 1 << 20,
+	"other":      1 << 20,
+}
+
+// proxyLimits bounds the bodies passed through the proxy; zero means no limit.
+type proxyLimits struct {
+	MaxRequestBody  int64
+	MaxResponseBody int64
+	// Endpoints overrides MaxRequestBody per endpoint class (see endpointClass).
+	Endpoints map[string]int64
+}
+
+func getProxyLimits() (proxyLimits, error) {
+	limits := proxyLimits{
+		MaxRequestBody:  getEnvSize("PROXY_MAX_REQUEST_BODY", 32<<20),
+		MaxResponseBody: getEnvSize("PROXY_MAX_RESPONSE_BODY", 0),
+		Endpoints:       maps.Clone(defaultEndpointBodyLimits),
+	}
+	overrides, err := parseEndpointLimits(getEnv("PROXY_MAX_REQUEST_BODY_ENDPOINTS", ""))
+	if err != nil {
+		return proxyLimits{}, fmt.Errorf("PROXY_MAX_REQUEST_BODY_ENDPOINTS: %w", err)
+	}
+	maps.Copy(limits.Endpoints, overrides)
+	return limits, nil
+}
+
+var endpointClasses = []string{"servers", "zones", "rrsets", "search", "statistics", "other"}
+
+// parseEndpointLimits parses "rrsets=64MiB,other=256KiB".
+func parseEndpointLimits(value string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, item := range splitList(value) {
+		class, size, ok := strings.Cut(item, "=")
+		class = strings.ToLower(strings.TrimSpace(class))
+		if !ok || !slices.Contains(endpointClasses, class) {
+			return nil, fmt.Errorf("invalid entry %q, use <endpoint>=<size> with endpoint one of %s", item, strings.Join(endpointClasses, ", "))
+		}
+		n, err := parseByteSize(strings.TrimSpace(size))
+		if err != nil {
+			return nil, err
+		}
+		limits[class] = n
+	}
+	return limits, nil
+}
+
+func (l proxyLimits) requestLimit(class string) int64 {
+	if limit, ok := l.Endpoints[class]; ok {
+		return limit
+	}
+	return l.MaxRequestBody
+}
+
+// readBody buffers the request body, which audit, history and the access
+// policy inspect, enforcing the size limit of the endpoint class and
+// rejecting malformed JSON before it reaches PowerDNS. It writes the error
+// response itself and reports whether the request may proceed.
+func (p *pdnsProxy) readBody(w http.ResponseWriter, r *http.Request, path string) ([]byte, bool) {
+	class := endpointClass(r.Method, path)
+	limit := p.limits.requestLimit(class)
+
+	if limit > 0 && r.ContentLength > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeMessage(class, r.ContentLength, limit))
+		return nil, false
+	}
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeMessage(class, -1, limit))
+			return nil, false
+		}
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return nil, false
+	}
+
+	if len(body) > 0 {
+		var doc json.RawMessage
+		if err := json.Unmarshal(body, &doc); err != nil {
+			writeError(w, http.StatusBadRequest, "request body is not valid JSON: "+err.Error())
+			return nil, false
+		}
+	}
+	return body, true
+}
+
+func bodyTooLargeMessage(class string, size, limit int64) string {
+	message := fmt.Sprintf("request body exceeds the %s limit for %s requests", formatByteSize(limit), class)
+	if size >= 0 {
+		message = fmt.Sprintf("request body of %s exceeds the %s limit for %s requests", formatByteSize(size), formatByteSize(limit), class)
+	}
+	if class == "rrsets" {
+		message += "; split the change into several smaller PATCH requests or raise the rrsets entry of PROXY_MAX_REQUEST_BODY_ENDPOINTS"
+	}
+	return message
+}
+
+func formatByteSize(n int64) string {
+	for _, unit := range []struct {
+		shift uint
+		name  string
+	}{{30, "GiB"}, {20, "MiB"}, {10, "KiB"}} {
+		if n >= 1<<unit.shift && n%(1<<unit.shift) == 0 {
+			return fmt.Sprintf("%d %s", n>>unit.shift, unit.name)
+		}
+	}
+	if n >= 1<<20 {
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
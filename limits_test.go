@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ─── readBody ────────────────────────────────────────────────────────────────
+
+func TestReadBody_RejectsMalformedJSON(t *testing.T) {
+	proxy := newTestProxy(newLimitTestBackend(t))
+	proxy.limits = proxyLimits{}
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{"rrsets": [`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "not valid JSON") {
+		t.Errorf("body = %s, want a JSON detail", w.Body.String())
+	}
+}
+
+func TestReadBody_EndpointLimits(t *testing.T) {
+	limits := proxyLimits{MaxRequestBody: 1 << 20, Endpoints: map[string]int64{"other": 32, "rrsets": 64}}
+	body := `{"rrsets":[{"name":"www.example.org.","type":"A","changetype":"DELETE"}]}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"rrsets over limit", http.MethodPatch, "servers/localhost/zones/example.org.", http.StatusRequestEntityTooLarge},
+		{"other over limit", http.MethodPost, "servers/localhost/tsigkeys", http.StatusRequestEntityTooLarge},
+		{"zones uses the default", http.MethodPost, "servers/localhost/zones", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := newTestProxy(newLimitTestBackend(t))
+			proxy.limits = limits
+			req := httptest.NewRequest(tt.method, "/api/pdns/"+tt.path, strings.NewReader(body))
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadBody_BulkRRsetMessage(t *testing.T) {
+	proxy := newTestProxy(newLimitTestBackend(t))
+	proxy.limits = proxyLimits{Endpoints: map[string]int64{"rrsets": 1 << 10}}
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{"rrsets":[`+strings.Repeat(`{},`, 1000)+`{}]}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+	for _, want := range []string{"1 KiB limit for rrsets", "several smaller PATCH requests"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("body = %s, want it to mention %q", w.Body.String(), want)
+		}
+	}
+}
+
+// ─── parseEndpointLimits ─────────────────────────────────────────────────────
+
+func TestParseEndpointLimits(t *testing.T) {
+	got, err := parseEndpointLimits("rrsets=64MiB, Other=256KiB")
+	if err != nil {
+		t.Fatalf("parseEndpointLimits: %v", err)
+	}
+	if got["rrsets"] != 64<<20 || got["other"] != 256<<10 {
+		t.Errorf("limits = %v", got)
+	}
+
+	for _, value := range []string{"rrsets", "records=1MiB", "rrsets=lots"} {
+		if _, err := parseEndpointLimits(value); err == nil {
+			t.Errorf("parseEndpointLimits(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestGetProxyLimits_Defaults(t *testing.T) {
+	unsetEnv(t, "PROXY_MAX_REQUEST_BODY", "PROXY_MAX_RESPONSE_BODY")
+	t.Setenv("PROXY_MAX_REQUEST_BODY_ENDPOINTS", "search=2MiB")
+
+	limits, err := getProxyLimits()
+	if err != nil {
+		t.Fatalf("getProxyLimits: %v", err)
+	}
+	if got := limits.requestLimit("rrsets"); got != 32<<20 {
+		t.Errorf("rrsets limit = %d, want 32 MiB", got)
+	}
+	if got := limits.requestLimit("servers"); got != 1<<20 {
+		t.Errorf("servers limit = %d, want 1 MiB", got)
+	}
+	if got := limits.requestLimit("search"); got != 2<<20 {
+		t.Errorf("search limit = %d, want 2 MiB override", got)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+// newLimitTestBackend answers every request with an empty JSON object and
+// returns its URL.
+func newLimitTestBackend(t *testing.T) string {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{})
+	}))
+	t.Cleanup(backend.Close)
+	return backend.URL
+}
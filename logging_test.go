@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ─── requestIDMiddleware ─────────────────────────────────────────────────────
+
+func TestRequestIDMiddleware_GeneratesID(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(seen) != 32 {
+		t.Errorf("generated request ID = %q, want 32 hex chars", seen)
+	}
+	if got := w.Header().Get(requestIDHeader); got != seen {
+		t.Errorf("response header = %q, want %q", got, seen)
+	}
+}
+
+func TestRequestIDMiddleware_KeepsClientID(t *testing.T) {
+	tests := map[string]bool{
+		"abc-123":                     true,
+		"":                            false,
+		"has space":                   false,
+		"line\nbreak":                 false,
+		strings.Repeat("x", 129):      false,
+		"8c1f0e4a-2b0d-4d6e-9a45-0f1": true,
+	}
+	for id, keep := range tests {
+		handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, id)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Header().Get(requestIDHeader); (got == id) != keep {
+			t.Errorf("X-Request-ID %q: response %q, keep = %t", id, got, keep)
+		}
+	}
+}
+
+// ─── proxy logging ───────────────────────────────────────────────────────────
+
+func TestProxy_LogsAndForwardsRequestID(t *testing.T) {
+	var upstreamID string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get(requestIDHeader)
+		writeJSON(w, http.StatusOK, []any{})
+	}))
+	defer backend.Close()
+
+	logs := captureLogs(t)
+	proxy := &pdnsProxy{
+		client:   backend.Client(),
+		backends: newBackendSet([]pdnsConfig{{Name: "main", URL: backend.URL, Key: "super-secret-key", ServerID: "localhost"}}),
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil)
+	req.Header.Set(requestIDHeader, "req-42")
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "alice"}))
+	w := httptest.NewRecorder()
+	requestIDMiddleware(proxy).ServeHTTP(w, req)
+
+	if upstreamID != "req-42" {
+		t.Errorf("upstream X-Request-ID = %q, want req-42", upstreamID)
+	}
+	if got := w.Header().Get(requestIDHeader); got != "req-42" {
+		t.Errorf("response X-Request-ID = %q, want req-42", got)
+	}
+	if strings.Contains(logs.String(), "super-secret-key") {
+		t.Errorf("log contains the API key: %s", logs)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not a JSON line: %v (%s)", err, logs)
+	}
+	want := map[string]any{
+		"msg":             "proxy request",
+		"request_id":      "req-42",
+		"user":            "alice",
+		"backend":         "main",
+		"method":          "GET",
+		"path":            "servers/localhost/zones",
+		"upstream_status": float64(200),
+		"bytes":           float64(3),
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("log %s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["latency_ms"]; !ok {
+		t.Error("log has no latency_ms")
+	}
+}
+
+func TestNewLogger_RejectsUnknownFormat(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
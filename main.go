@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"embed"
 	"encoding/json"
 	"errors"
@@ -12,20 +13,28 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 )
 
 type pdnsConfig struct {
-	URL      string
-	Key      string
-	ServerID string
+	Name     string `json:"name" yaml:"name"`
+	URL      string `json:"url" yaml:"url"`
+	Key      string `json:"api_key" yaml:"api_key"`
+	KeyFile  string `json:"api_key_file" yaml:"api_key_file"`
+	ServerID string `json:"server_id" yaml:"server_id"`
+	// ReadOnly rejects every change to this backend.
+	ReadOnly bool `json:"read_only" yaml:"read_only"`
 }
 
 var allowedProxyMethods = map[string]bool{
@@ -36,25 +45,58 @@ var allowedProxyMethods = map[string]bool{
 	http.MethodDelete: true,
 }
 
+const dotEnvPath = ".env"
+
 //go:embed templates static
 var uiFS embed.FS
 
 var uiVersion = detectUIVersion()
 
 type listenConfig struct {
-	Host string
-	Port string
+	Host       string
+	Port       string
+	ConfigFile string
+	Config     *fileConfig
+	TLS        tlsConfig
+	ReadOnly   bool
 }
 
 func main() {
-	loadDotEnv(".env")
+	baseEnv := environKeys()
+	loadDotEnv(dotEnvPath)
 
 	listenCfg, err := parseListenConfig(os.Args[1:], os.Stdout)
 	if err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return
 		}
-		log.Fatalf("failed to parse command line flags: %v", err)
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+
+	var logOutput io.Writer = os.Stderr
+	if logFile := getEnv("LOG_FILE", ""); logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("failed to open log file: %v", err)
+		}
+		defer f.Close()
+		logOutput = f
+	}
+	logger, err := newLogger(logOutput, getEnv("LOG_FORMAT", "json"))
+	if err != nil {
+		log.Fatalf("LOG_FORMAT: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	var serverTLS *tls.Config
+	if listenCfg.TLS.ClientCAFile != "" && !listenCfg.TLS.enabled() {
+		log.Fatalf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if listenCfg.TLS.enabled() {
+		serverTLS, err = listenCfg.TLS.serverConfig()
+		if err != nil {
+			log.Fatalf("invalid TLS settings: %v", err)
+		}
 	}
 
 	indexTemplate, err := template.ParseFS(uiFS, "templates/index.html")
@@ -62,25 +104,188 @@ func main() {
 		log.Fatalf("failed to parse template: %v", err)
 	}
 
+	loginTemplate, err := template.ParseFS(uiFS, "templates/login.html")
+	if err != nil {
+		log.Fatalf("failed to parse template: %v", err)
+	}
+
 	staticFS, err := fs.Sub(uiFS, "static")
 	if err != nil {
 		log.Fatalf("failed to create static filesystem: %v", err)
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	transport, err := newUpstreamTransport(getUpstreamTLSConfig())
+	if err != nil {
+		log.Fatalf("invalid PowerDNS TLS settings: %v", err)
+	}
+	timeouts, err := getProxyTimeouts()
+	if err != nil {
+		log.Fatalf("invalid proxy timeouts: %v", err)
+	}
+	timeouts.configure(transport)
+	// Proxied requests are bounded per endpoint class by proxyTimeouts; the
+	// readiness probes and statistics scrapes set their own deadlines.
+	client := &http.Client{Transport: transport}
+	authCfg := getAuthConfig()
+	oidcCfg, err := getOIDCConfig()
+	if err != nil {
+		log.Fatalf("invalid OIDC settings: %v", err)
+	}
+	proxyAuthCfg, err := getProxyAuthConfig()
+	if err != nil {
+		log.Fatalf("invalid proxy authentication settings: %v", err)
+	}
+
+	limits, err := getProxyLimits()
+	if err != nil {
+		log.Fatalf("invalid proxy limits: %v", err)
+	}
+	proxy := &pdnsProxy{
+		client:   client,
+		metrics:  newProxyMetrics(),
+		limits:   limits,
+		timeouts: timeouts,
+		retry:    getRetryConfig(),
+		breakers: newCircuitBreakers(getBreakerConfig()),
+		readOnly: listenCfg.ReadOnly,
+	}
+	cacheTTLs, err := getCacheTTLs()
+	if err != nil {
+		log.Fatalf("invalid response cache settings: %v", err)
+	}
+	proxy.cache = newResponseCache(cacheTTLs, getEnvSize("PROXY_CACHE_MAX_SIZE", defaultCacheMaxSize))
+	if proxy.readOnly {
+		log.Printf("read-only mode: changes to PowerDNS are disabled")
+	}
+	backends, err := loadBackendConfig(listenCfg.Config)
+	if err != nil {
+		log.Fatalf("failed to load PowerDNS backends: %v", err)
+	}
+	proxy.backends = newBackendSet(backends)
+
+	proxy.policy, err = loadPolicyConfig(listenCfg.Config)
+	if err != nil {
+		log.Fatalf("failed to load access policy: %v", err)
+	}
+
+	reloader := &configReloader{
+		dotEnvPath: dotEnvPath,
+		configFile: listenCfg.ConfigFile,
+		baseEnv:    baseEnv,
+		backends:   proxy.backends,
+		policy:     proxy.policy,
+	}
+	go reloader.run(getEnvDuration("CONFIG_WATCH_INTERVAL", 0))
+
+	if auditCfg := getAuditConfig(); auditCfg.enabled() {
+		proxy.audit, err = newAuditLog(auditCfg)
+		if err != nil {
+			log.Fatalf("failed to open audit log: %v", err)
+		}
+		defer proxy.audit.Close()
+	}
+
+	if historyFile := getEnv("HISTORY_FILE", ""); historyFile != "" {
+		proxy.history, err = newHistoryStore(historyFile)
+		if err != nil {
+			log.Fatalf("failed to open change history: %v", err)
+		}
+		defer proxy.history.Close()
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
-	mux.HandleFunc("/api/config", handleAPIConfig)
-	mux.HandleFunc("/api/pdns", handlePDNSProxy(client))
-	mux.HandleFunc("/api/pdns/", handlePDNSProxy(client))
+	health := newHealthState(client, proxy.backends, getEnvDuration("READINESS_CACHE_TTL", 5*time.Second))
+	health.breakers = proxy.breakers
+	mux.HandleFunc("/healthz", handleHealth)
+	mux.HandleFunc("/readyz", health.handleReady)
+	metricsSources := []metricsSource{proxy.metrics}
+	if interval := getEnvDuration("PDNS_STATS_INTERVAL", 0); interval > 0 {
+		stats := newStatsCollector(client, proxy.backends, interval)
+		stats.rings = getEnvBool("PDNS_STATS_RINGS", false)
+		go stats.run(context.Background())
+		metricsSources = append(metricsSources, stats)
+		log.Printf("re-exporting PowerDNS statistics every %s", interval)
+	}
+	mux.HandleFunc("/metrics", handleMetrics(metricsSources...))
+	mux.HandleFunc("/api/readyz", health.handleReadyDetail)
+	mux.HandleFunc("/api/config", handleAPIConfig(proxy.backends, listenCfg.ReadOnly))
+	mux.HandleFunc("/api/audit", handleAuditQuery(proxy.audit, proxy.policy))
+	mux.HandleFunc("/api/history/{zone}", proxy.handleHistory)
+	mux.HandleFunc("/api/history/{zone}/{id}/revert", proxy.handleRevert)
+	mux.Handle("/api/pdns", proxy)
+	mux.Handle("/api/pdns/", proxy)
 	mux.HandleFunc("/", handleIndex(indexTemplate))
 
+	var handler http.Handler = mux
+	clientCertCfg, err := getClientCertConfig()
+	if err != nil {
+		log.Fatalf("invalid client certificate settings: %v", err)
+	}
+	mtls := listenCfg.TLS.ClientCAFile != ""
+
+	if authCfg.UsersFile != "" || oidcCfg.IssuerURL != "" || proxyAuthCfg.enabled() || mtls {
+		auth, err := newAuthenticator(authCfg, loginTemplate)
+		if err != nil {
+			log.Fatalf("failed to initialize authentication: %v", err)
+		}
+		auth.proxyAuth = proxyAuthCfg
+		if mtls {
+			auth.clientCert = &clientCertCfg
+		}
+		if oidcCfg.IssuerURL != "" {
+			auth.oidc, err = newOIDCProvider(oidcCfg, &http.Client{Timeout: 15 * time.Second}, auth)
+			if err != nil {
+				log.Fatalf("failed to initialize OIDC: %v", err)
+			}
+			mux.HandleFunc(oidcLoginPath, auth.oidc.handleLogin)
+			mux.HandleFunc(oidcCallbackPath, auth.oidc.handleCallback)
+		}
+		mux.HandleFunc("/login", auth.handleLogin)
+		mux.HandleFunc("/logout", auth.handleLogout)
+		handler = auth.middleware(mux)
+	} else {
+		log.Printf("WARNING: authentication is disabled, set AUTH_USERS_FILE, OIDC_ISSUER_URL, AUTH_PROXY_TRUSTED_CIDRS or TLS_CLIENT_CA_FILE to require login")
+	}
+
+	handler = requestIDMiddleware(handler)
+
 	addr := net.JoinHostPort(listenCfg.Host, listenCfg.Port)
 
-	log.Printf("PowerDNS Web UI listening on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("server error: %v", err)
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: serverTLS}
+	servers := []*http.Server{server}
+	serveErr := make(chan error, 2)
+
+	if serverTLS != nil {
+		if redirectAddr := listenCfg.TLS.RedirectAddr; redirectAddr != "" {
+			redirect := &http.Server{Addr: redirectAddr, Handler: redirectToHTTPS(listenCfg.Port, listenCfg.TLS.RedirectHost, serverTLS.GetCertificate)}
+			servers = append(servers, redirect)
+			log.Printf("redirecting HTTP on %s to HTTPS", redirectAddr)
+			go func() { serveErr <- redirect.ListenAndServe() }()
+		}
+
+		log.Printf("PowerDNS Web UI listening on %s (TLS)", addr)
+		go func() { serveErr <- server.ListenAndServeTLS("", "") }()
+	} else {
+		log.Printf("PowerDNS Web UI listening on %s", addr)
+		go func() { serveErr <- server.ListenAndServe() }()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	case <-ctx.Done():
+		stop()
+		log.Printf("shutting down")
+		if err := gracefulShutdown(health, getShutdownConfig(), servers...); err != nil {
+			log.Printf("shutdown error: %v", err)
+		}
+		log.Printf("shutdown complete")
 	}
 }
 
@@ -89,11 +294,16 @@ func parseListenConfig(args []string, output io.Writer) (listenConfig, error) {
 		Host: getEnv("HOST", "0.0.0.0"),
 		Port: getEnv("PORT", "8080"),
 	}
+	cfg.ConfigFile = getEnv("CONFIG_FILE", "")
 
 	flags := flag.NewFlagSet("pdns-webui", flag.ContinueOnError)
 	flags.SetOutput(output)
+	flags.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "Path to a YAML configuration file")
 	flags.StringVar(&cfg.Host, "host", cfg.Host, "Host/interface to listen on")
 	flags.StringVar(&cfg.Port, "port", cfg.Port, "Port to listen on")
+	tlsCert := flags.String("tls-cert", getEnv("TLS_CERT_FILE", ""), "PEM certificate file; enables HTTPS")
+	tlsKey := flags.String("tls-key", getEnv("TLS_KEY_FILE", ""), "PEM private key file for -tls-cert")
+	flags.BoolVar(&cfg.ReadOnly, "read-only", getEnvBool("READ_ONLY", false), "Reject every change to PowerDNS")
 	flags.Usage = func() {
 		fmt.Fprintf(output, "Usage: %s [options]\n\n", os.Args[0])
 		fmt.Fprintln(output, "Options:")
@@ -104,6 +314,37 @@ func parseListenConfig(args []string, output io.Writer) (listenConfig, error) {
 		return listenConfig{}, err
 	}
 
+	if cfg.ConfigFile != "" {
+		fileCfg, err := loadConfigFile(cfg.ConfigFile)
+		if err != nil {
+			return listenConfig{}, err
+		}
+		if err := fileCfg.applyEnv(); err != nil {
+			return listenConfig{}, err
+		}
+		cfg.Config = fileCfg
+	}
+
+	// Re-read defaults that the config file may have provided; explicit flags win.
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	cfg.TLS = getTLSConfig()
+	if set["tls-cert"] {
+		cfg.TLS.CertFile = *tlsCert
+	}
+	if set["tls-key"] {
+		cfg.TLS.KeyFile = *tlsKey
+	}
+	if !set["host"] {
+		cfg.Host = getEnv("HOST", "0.0.0.0")
+	}
+	if !set["port"] {
+		cfg.Port = getEnv("PORT", "8080")
+	}
+	if !set["read-only"] {
+		cfg.ReadOnly = getEnvBool("READ_ONLY", false)
+	}
+
 	return cfg, nil
 }
 
@@ -122,17 +363,41 @@ func handleIndex(indexTemplate *template.Template) http.HandlerFunc {
 	}
 }
 
-func handleAPIConfig(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+func readOnlyMessage(global bool, cfg pdnsConfig) string {
+	if global {
+		return "this PowerDNS Web UI instance is read-only; changes are disabled"
 	}
+	return fmt.Sprintf("PowerDNS backend %q is read-only; changes are disabled", cfg.Name)
+}
+
+func handleAPIConfig(backends *backendSet, readOnly bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		resolved := backends.get()
+		list := make([]map[string]any, 0, len(resolved))
+		for _, backend := range resolved {
+			list = append(list, map[string]any{
+				"name":      backend.Name,
+				"server_id": backend.ServerID,
+				"read_only": readOnly || backend.ReadOnly,
+			})
+		}
 
-	cfg := getPDNSConfig()
-	writeJSON(w, http.StatusOK, map[string]string{
-		"server_id":  cfg.ServerID,
-		"ui_version": uiVersion,
-	})
+		payload := map[string]any{
+			"server_id":  resolved[0].ServerID,
+			"ui_version": uiVersion,
+			"read_only":  readOnly,
+			"backends":   list,
+		}
+		if id, ok := identityFromContext(r.Context()); ok {
+			payload["user"] = id.User
+		}
+		writeJSON(w, http.StatusOK, payload)
+	}
 }
 
 func detectUIVersion() string {
@@ -172,99 +437,274 @@ func detectUIVersion() string {
 	return shortRevision
 }
 
+type pdnsProxy struct {
+	client   *http.Client
+	backends *backendSet
+	policy   *accessPolicy
+	audit    *auditLog
+	history  *historyStore
+	metrics  *proxyMetrics
+	limits   proxyLimits
+	timeouts proxyTimeouts
+	retry    retryConfig
+	breakers *circuitBreakers
+	cache    *responseCache
+	// readOnly rejects changes to every backend, see pdnsConfig.ReadOnly.
+	readOnly bool
+}
+
 func handlePDNSProxy(client *http.Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !allowedProxyMethods[r.Method] {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
+	return (&pdnsProxy{client: client}).ServeHTTP
+}
 
-		cfg := getPDNSConfig()
+func (p *pdnsProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedProxyMethods[r.Method] {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
 
-		path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/pdns/")
-		if path == r.URL.EscapedPath() {
-			path = ""
-		}
-		if path == "" {
-			http.NotFound(w, r)
-			return
-		}
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/pdns/")
+	if path == r.URL.EscapedPath() {
+		path = ""
+	}
 
-		targetURL := fmt.Sprintf("%s/api/v1/%s", cfg.URL, path)
-		if r.URL.RawQuery != "" {
-			targetURL += "?" + r.URL.RawQuery
-		}
+	cfg, path := p.backendFor(path)
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
 
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, "failed to read request body")
+	target, err := parseProxyTarget(path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, ok := p.readBody(w, r, path)
+	if !ok {
+		return
+	}
+
+	if p.audit != nil && r.Method != http.MethodGet {
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			id, _ := identityFromContext(r.Context())
+			p.audit.record(auditEntry{
+				Time:       time.Now().UTC(),
+				User:       requestUser(r),
+				AuthSource: id.Source,
+				RemoteAddr: r.RemoteAddr,
+				RequestID:  requestID(r.Context()),
+				Backend:    cfg.Name,
+				Method:     r.Method,
+				Path:       path,
+				Zone:       target.Zone,
+				Changes:    rrsetChanges(body),
+				Status:     recorder.status,
+			})
+		}()
+	}
+
+	if r.Method != http.MethodGet && (p.readOnly || cfg.ReadOnly) {
+		requestLogger(r).Warn("proxy request denied", "backend", cfg.Name, "method", r.Method, "path", path, "error", "read-only mode")
+		writeError(w, http.StatusForbidden, readOnlyMessage(p.readOnly, cfg))
+		return
+	}
+
+	if err := p.authorizeEndpoint(r, path); err != nil {
+		requestLogger(r).Warn("proxy request denied", "backend", cfg.Name, "method", r.Method, "path", path, "error", err)
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if p.policy != nil {
+		id, _ := identityFromContext(r.Context())
+		if err := p.policy.authorize(id, r.Method, target); err != nil {
+			requestLogger(r).Warn("proxy request denied", "backend", cfg.Name, "method", r.Method, "path", path, "error", err)
+			writeError(w, http.StatusForbidden, err.Error())
 			return
 		}
+	}
 
-		req, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, bytes.NewReader(body))
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+	if p.history != nil && r.Method == http.MethodPatch && target.Zone != "" && target.Sub == "" {
+		if changes := rrsetChanges(body); len(changes) > 0 {
+			err := p.recordHistory(r, cfg, path, target, changes, func() int {
+				recorder := &statusRecorder{ResponseWriter: w}
+				p.forward(recorder, r, cfg, path, body)
+				return recorder.status
+			})
+			if err != nil {
+				writeSnapshotError(w, err, cfg)
+			}
 			return
 		}
+	}
 
-		req.Header.Set("X-API-Key", cfg.Key)
-		req.Header.Set("Accept", "application/json")
-		if len(body) > 0 {
-			req.Header.Set("Content-Type", "application/json")
-		}
+	if ttl := p.cache.ttl(timeoutClass(r.Method, path)); r.Method == http.MethodGet && ttl > 0 {
+		p.forwardCached(w, r, cfg, path, ttl)
+		return
+	}
+	p.forward(w, r, cfg, path, body)
+}
 
-		log.Printf("%s %s", r.Method, targetURL)
+// forward sends the request to the PowerDNS API and copies the response. It
+// reports whether the complete response reached the client.
+func (p *pdnsProxy) forward(w http.ResponseWriter, r *http.Request, cfg pdnsConfig, path string, body []byte) bool {
+	targetURL := fmt.Sprintf("%s/api/v1/%s", cfg.URL, path)
+	if r.URL.RawQuery != "" {
+		targetURL += "?" + r.URL.RawQuery
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			status, message := mapProxyError(err, cfg)
-			writeError(w, status, message)
-			return
+	class := timeoutClass(r.Method, path)
+	ctx, cancel := p.timeouts.withTotalTimeout(r.Context(), class)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, targetURL, bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	req.Header.Set("X-API-Key", cfg.Key)
+	req.Header.Set("Accept", "application/json")
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := requestID(r.Context()); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	logger := requestLogger(r).With("backend", cfg.Name, "method", r.Method, "path", path)
+
+	start := time.Now()
+	resp, err := p.do(req, cfg, class)
+	if err != nil {
+		elapsed := time.Since(start)
+		p.metrics.observe(cfg, r.Method, path, 0, err, elapsed)
+		status, message := mapProxyError(err, cfg)
+		logger.Warn("proxy request failed", "status", status, "latency_ms", elapsed.Milliseconds(), "error", err)
+		var openErr *circuitOpenError
+		if errors.As(err, &openErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(openErr.retryIn.Round(time.Second).Seconds()), 1)))
 		}
-		defer resp.Body.Close()
+		writeError(w, status, message)
+		return false
+	}
+	defer resp.Body.Close()
+	if r.Method != http.MethodGet && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		p.cache.invalidate(cfg.Name, path)
+	}
 
-		if resp.StatusCode == http.StatusNoContent {
-			w.WriteHeader(http.StatusNoContent)
-			return
+	written, err := p.copyResponse(w, resp)
+	elapsed := time.Since(start)
+	p.metrics.observe(cfg, r.Method, path, resp.StatusCode, nil, elapsed)
+	if err != nil {
+		logger.Warn("failed to copy upstream response", "upstream_status", resp.StatusCode, "bytes", written, "latency_ms", elapsed.Milliseconds(), "error", err)
+		if written > 0 {
+			// Part of the body is already sent (the response grew past the
+			// size limit or the total timeout fired); abort the connection so
+			// the client does not mistake the truncated body for a complete one.
+			panic(http.ErrAbortHandler)
 		}
+		return false
+	}
+	logger.Info("proxy request", "upstream_status", resp.StatusCode, "bytes", written, "latency_ms", elapsed.Milliseconds())
+	return true
+}
+
+var errResponseTooLarge = errors.New("PowerDNS response exceeds the size limit")
+
+// copyResponse streams JSON responses to the client unchanged and wraps other
+// content as {"result": "..."}. It returns the number of body bytes written.
+func (p *pdnsProxy) copyResponse(w http.ResponseWriter, resp *http.Response) (int64, error) {
+	limit := p.limits.MaxResponseBody
+	if limit > 0 && resp.ContentLength > limit {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("PowerDNS response of %d bytes exceeds the %d byte limit", resp.ContentLength, limit))
+		return 0, errResponseTooLarge
+	}
 
-		respBody, err := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return 0, nil
+	}
+
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		// Read one byte past the limit to detect oversized chunked bodies.
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(strings.ToLower(contentType), "application/json") {
+		data, err := io.ReadAll(body)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
-			return
+			writeError(w, http.StatusBadGateway, err.Error())
+			return 0, err
 		}
-
-		contentType := strings.ToLower(resp.Header.Get("Content-Type"))
-		if strings.Contains(contentType, "application/json") {
-			var payload any
-			if err := json.Unmarshal(respBody, &payload); err == nil {
-				writeJSON(w, resp.StatusCode, payload)
-				return
-			}
+		if limit > 0 && int64(len(data)) > limit {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("PowerDNS response exceeds the %d byte limit", limit))
+			return 0, errResponseTooLarge
 		}
+		writeJSON(w, resp.StatusCode, map[string]string{"result": string(data)})
+		return int64(len(data)), nil
+	}
 
-		writeJSON(w, resp.StatusCode, map[string]string{
-			"result": string(respBody),
-		})
+	w.Header().Set("Content-Type", contentType)
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+	written, err := io.Copy(w, body)
+	if err != nil {
+		return written, err
+	}
+	if limit > 0 && written > limit {
+		return written, errResponseTooLarge
 	}
+	return written, nil
 }
 
 func mapProxyError(err error, cfg pdnsConfig) (status int, message string) {
-	var netErr net.Error
-	if errors.As(err, &netErr) && netErr.Timeout() {
+	switch proxyErrorReason(err) {
+	case "circuit_open":
+		return http.StatusServiceUnavailable, err.Error()
+	case "timeout":
+		var timeoutErr *upstreamTimeoutError
+		if errors.As(err, &timeoutErr) {
+			return http.StatusGatewayTimeout, timeoutErr.Error()
+		}
 		return http.StatusGatewayTimeout, "PowerDNS API request timed out"
+	case "connect_refused":
+		return http.StatusServiceUnavailable, fmt.Sprintf("Cannot connect to PowerDNS API at %s: %v", cfg.URL, err)
 	}
 
+	slog.Error("unexpected proxy error", "backend", cfg.Name, "error", err)
+	return http.StatusInternalServerError, err.Error()
+}
+
+// proxyErrorReason classifies a failed upstream request: "circuit_open",
+// "timeout", "connect_refused" or "other".
+func proxyErrorReason(err error) string {
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		return "circuit_open"
+	}
+	var timeoutErr *upstreamTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return "timeout"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
 	if errors.Is(err, context.DeadlineExceeded) {
-		return http.StatusGatewayTimeout, "PowerDNS API request timed out"
+		return "timeout"
 	}
-
 	if isConnectError(err) {
-		return http.StatusServiceUnavailable, fmt.Sprintf("Cannot connect to PowerDNS API at %s: %v", cfg.URL, err)
+		return "connect_refused"
 	}
-
-	log.Printf("unexpected proxy error: %v", err)
-	return http.StatusInternalServerError, err.Error()
+	return "other"
 }
 
 func isConnectError(err error) bool {
@@ -286,7 +726,8 @@ func isConnectError(err error) bool {
 func getPDNSConfig() pdnsConfig {
 	return pdnsConfig{
 		URL:      strings.TrimRight(getEnv("PDNS_API_URL", "http://localhost:8081"), "/"),
-		Key:      getEnv("PDNS_API_KEY", "changeme"),
+		Name:     defaultBackendName,
+		Key:      getSecretEnv("PDNS_API_KEY", "changeme"),
 		ServerID: getEnv("PDNS_SERVER_ID", "localhost"),
 	}
 }
@@ -298,6 +739,119 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getSecret reads the value from the file named by key+"_FILE" when that is
+// set, so Docker and Kubernetes secrets can be mounted, and otherwise falls
+// back to getEnv. Trailing newlines are trimmed.
+func getSecret(key, fallback string) (string, error) {
+	path := getEnv(key+"_FILE", "")
+	if path == "" {
+		return getEnv(key, fallback), nil
+	}
+	return readSecretFile(path)
+}
+
+// getSecretEnv is getSecret for callers without error handling; an unreadable
+// file is logged and yields the fallback.
+func getSecretEnv(key, fallback string) string {
+	value, err := getSecret(key, fallback)
+	if err != nil {
+		log.Printf("failed to read %s_FILE, using default: %v", key, err)
+		return fallback
+	}
+	return value
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid duration in %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("invalid non-negative integer in %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvSize reads a byte size such as 1048576, 512KiB, 32MiB or 1GiB.
+func getEnvSize(key string, fallback int64) int64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	size, err := parseByteSize(value)
+	if err != nil {
+		log.Printf("invalid size in %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return size
+}
+
+func parseByteSize(value string) (int64, error) {
+	number := strings.TrimRight(value, "KMGiBkmgib")
+	unit := strings.ToUpper(strings.TrimSpace(value[len(number):]))
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	var shift uint
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I") {
+	case "":
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	default:
+		return 0, fmt.Errorf("invalid size unit in %q", value)
+	}
+	if n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return n << shift, nil
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid boolean in %s=%q, using %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
 func writeError(w http.ResponseWriter, status int, detail string) {
 	writeJSON(w, status, map[string]string{"detail": detail})
 }
@@ -306,7 +860,7 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		log.Printf("failed to write json response: %v", err)
+		slog.Error("failed to write json response", "error", err)
 	}
 }
 
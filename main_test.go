@@ -14,7 +14,9 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -31,6 +33,14 @@ func newProxyClient() *http.Client {
 	return &http.Client{Timeout: 15 * time.Second}
 }
 
+// newTestProxy возвращает прокси с единственным бэкендом "main" по адресу url.
+func newTestProxy(url string) *pdnsProxy {
+	return &pdnsProxy{
+		client:   newProxyClient(),
+		backends: newBackendSet([]pdnsConfig{{Name: "main", URL: url, ServerID: "localhost"}}),
+	}
+}
+
 // proxyHandler создаёт обработчик прокси с клиентом по умолчанию.
 func proxyHandler() http.HandlerFunc {
 	return handlePDNSProxy(newProxyClient())
@@ -130,6 +140,45 @@ func TestGetEnv_EmptyValueReturnsFallback(t *testing.T) {
 	}
 }
 
+// ─── getSecret ────────────────────────────────────────────────────────────────
+
+func TestGetSecret_ReadsFileAndTrimsNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_key")
+	if err := os.WriteFile(path, []byte("s3cret\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv("TEST_SECRET_FILE", path)
+
+	got, err := getSecret("TEST_SECRET", "fallback")
+	if err != nil {
+		t.Fatalf("getSecret: %v", err)
+	}
+	if got != "s3cret" {
+		t.Errorf("got %q, want %q (file wins over the variable)", got, "s3cret")
+	}
+}
+
+func TestGetSecret_FallsBackToEnv(t *testing.T) {
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv("TEST_SECRET_FILE", "")
+
+	if got, err := getSecret("TEST_SECRET", "fallback"); err != nil || got != "from-env" {
+		t.Errorf("got %q, %v; want %q", got, err, "from-env")
+	}
+}
+
+func TestGetSecret_MissingFile(t *testing.T) {
+	t.Setenv("TEST_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := getSecret("TEST_SECRET", "fallback"); err == nil {
+		t.Error("expected error")
+	}
+	if got := getSecretEnv("TEST_SECRET", "fallback"); got != "fallback" {
+		t.Errorf("getSecretEnv = %q, want fallback", got)
+	}
+}
+
 // ─── parseListenConfig ───────────────────────────────────────────────────────
 
 func TestParseListenConfig_DefaultsFromEnv(t *testing.T) {
@@ -183,6 +232,26 @@ func TestParseListenConfig_FlagsOverrideEnv(t *testing.T) {
 	}
 }
 
+func TestParseListenConfig_ReadOnly(t *testing.T) {
+	t.Setenv("READ_ONLY", "true")
+
+	cfg, err := parseListenConfig(nil, io.Discard)
+	if err != nil {
+		t.Fatalf("parseListenConfig returned error: %v", err)
+	}
+	if !cfg.ReadOnly {
+		t.Error("ReadOnly = false, want READ_ONLY=true to apply")
+	}
+
+	cfg, err = parseListenConfig([]string{"-read-only=false"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseListenConfig returned error: %v", err)
+	}
+	if cfg.ReadOnly {
+		t.Error("ReadOnly = true, want -read-only=false to override READ_ONLY")
+	}
+}
+
 func TestParseListenConfig_Help(t *testing.T) {
 	var out bytes.Buffer
 
@@ -248,14 +317,14 @@ func TestHandleAPIConfig_GET_ReturnsServerIDAndVersion(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
 	w := httptest.NewRecorder()
-	handleAPIConfig(w, req)
+	handleAPIConfig(nil, false)(w, req)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
 	}
 
-	var body map[string]string
+	var body map[string]any
 	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
 		t.Fatalf("decode body: %v", err)
 	}
@@ -267,10 +336,39 @@ func TestHandleAPIConfig_GET_ReturnsServerIDAndVersion(t *testing.T) {
 	}
 }
 
+func TestHandleAPIConfig_AdvertisesReadOnly(t *testing.T) {
+	backends := newBackendSet([]pdnsConfig{
+		{Name: "primary", ServerID: "localhost"},
+		{Name: "replica", ServerID: "localhost", ReadOnly: true},
+	})
+
+	for _, global := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		handleAPIConfig(backends, global)(w, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+
+		var body struct {
+			ReadOnly bool `json:"read_only"`
+			Backends []struct {
+				Name     string `json:"name"`
+				ReadOnly bool   `json:"read_only"`
+			} `json:"backends"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if body.ReadOnly != global {
+			t.Errorf("global=%v: read_only = %v", global, body.ReadOnly)
+		}
+		if len(body.Backends) != 2 || body.Backends[0].ReadOnly != global || !body.Backends[1].ReadOnly {
+			t.Errorf("global=%v: backends = %+v", global, body.Backends)
+		}
+	}
+}
+
 func TestHandleAPIConfig_GET_ContentTypeIsJSON(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
 	w := httptest.NewRecorder()
-	handleAPIConfig(w, req)
+	handleAPIConfig(nil, false)(w, req)
 
 	ct := w.Result().Header.Get("Content-Type")
 	if !strings.Contains(ct, "application/json") {
@@ -285,7 +383,7 @@ func TestHandleAPIConfig_MethodNotAllowed(t *testing.T) {
 		t.Run(method, func(t *testing.T) {
 			req := httptest.NewRequest(method, "/api/config", nil)
 			w := httptest.NewRecorder()
-			handleAPIConfig(w, req)
+			handleAPIConfig(nil, false)(w, req)
 
 			if w.Code != http.StatusMethodNotAllowed {
 				t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
@@ -532,6 +630,167 @@ func TestHandlePDNSProxy_NonJSONBackend_WrapsInResult(t *testing.T) {
 	}
 }
 
+// ─── handlePDNSProxy — режим только для чтения ───────────────────────────────
+
+func TestHandlePDNSProxy_ReadOnly_RejectsChanges(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		if r.Method != http.MethodGet {
+			t.Errorf("%s reached the backend in read-only mode", r.Method)
+		}
+		writeJSON(w, http.StatusOK, []any{})
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name     string
+		global   bool
+		readOnly bool
+		detail   string
+	}{
+		{"global", true, false, "instance is read-only"},
+		{"backend", false, true, `backend "main" is read-only`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamCalls.Store(0)
+			proxy := &pdnsProxy{
+				client:   newProxyClient(),
+				backends: newBackendSet([]pdnsConfig{{Name: "main", URL: backend.URL, ServerID: "localhost", ReadOnly: tt.readOnly}}),
+				readOnly: tt.global,
+			}
+
+			for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+				w := httptest.NewRecorder()
+				proxy.ServeHTTP(w, httptest.NewRequest(method, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{}`)))
+				if w.Code != http.StatusForbidden {
+					t.Errorf("%s status = %d, want 403", method, w.Code)
+				}
+				var body map[string]string
+				json.NewDecoder(w.Body).Decode(&body)
+				if !strings.Contains(body["detail"], tt.detail) {
+					t.Errorf("%s detail = %q, want it to contain %q", method, body["detail"], tt.detail)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("GET status = %d, want 200", w.Code)
+			}
+			if got := upstreamCalls.Load(); got != 1 {
+				t.Errorf("upstream calls = %d, want only the GET", got)
+			}
+		})
+	}
+}
+
+// ─── handlePDNSProxy — потоковая передача и лимиты ────────────────────────────
+
+func TestHandlePDNSProxy_StreamsJSONUnchanged(t *testing.T) {
+	// Whitespace and key order survive only if the body is not re-encoded.
+	upstream := "{\n  \"z\": 1,\n  \"a\": [ 1, 2 ]\n}\n"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(w, upstream)
+	}))
+	defer backend.Close()
+
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	w := httptest.NewRecorder()
+	proxyHandler()(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones/example.org.", nil))
+
+	if w.Body.String() != upstream {
+		t.Errorf("body = %q, want upstream bytes %q", w.Body.String(), upstream)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestHandlePDNSProxy_RequestBodyLimit_Returns413(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("oversized request reached the backend")
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	proxy.limits = proxyLimits{MaxRequestBody: 16}
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{"rrsets":[{"name":"www.example.org."}]}`))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestHandlePDNSProxy_ResponseContentLengthLimit_Returns502(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"rrsets":[1,2,3,4,5,6,7,8,9]}`)
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	proxy.limits = proxyLimits{MaxResponseBody: 10}
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones/example.org.", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", w.Code)
+	}
+}
+
+func TestHandlePDNSProxy_ChunkedResponseLimit_AbortsConnection(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for range 100 {
+			io.WriteString(w, `{"rrset":"padding"},`)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	proxy.limits = proxyLimits{MaxResponseBody: 64}
+	front := httptest.NewServer(proxy)
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/api/pdns/servers/localhost/zones/example.org.")
+	if err != nil {
+		return // the connection was aborted before the headers arrived
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("truncated response was delivered as complete")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"1048576": 1 << 20,
+		"512KiB":  512 << 10,
+		"32MiB":   32 << 20,
+		"32M":     32 << 20,
+		"1GiB":    1 << 30,
+		"2 GB":    2 << 30,
+	}
+	for value, want := range tests {
+		got, err := parseByteSize(value)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "lots", "-1", "10TB", "99999999999999GiB"} {
+		if _, err := parseByteSize(value); err == nil {
+			t.Errorf("parseByteSize(%q) succeeded, want error", value)
+		}
+	}
+}
+
 // ─── handlePDNSProxy — live интеграционные тесты (только безопасные GET) ─────
 
 func TestLivePDNS_GetServers_ProxyMatchesDirect(t *testing.T) {
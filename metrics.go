@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the upstream latency
+// histogram; the last one matches the default response header timeout.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// proxyMetrics counts proxied PowerDNS API calls. Label values come from
+// small fixed sets (backends, methods, endpoint classes, status codes), so
+// the series count stays bounded.
+type proxyMetrics struct {
+	mu        sync.Mutex
+	requests  map[requestLabels]*histogram
+	errors    map[errorLabels]uint64
+	startTime time.Time
+}
+
+type requestLabels struct {
+	backend  string
+	method   string
+	endpoint string
+	status   string
+}
+
+type errorLabels struct {
+	backend string
+	reason  string
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newProxyMetrics() *proxyMetrics {
+	return &proxyMetrics{
+		requests:  make(map[requestLabels]*histogram),
+		errors:    make(map[errorLabels]uint64),
+		startTime: time.Now(),
+	}
+}
+
+// endpointClass groups PowerDNS API paths (relative to /api/v1) into the
+// classes used as metric labels.
+func endpointClass(method, path string) string {
+	segments := strings.Split(path, "/")
+	if segments[0] != "servers" {
+		return "other"
+	}
+	if len(segments) < 3 || segments[2] == "" {
+		return "servers"
+	}
+
+	switch segments[2] {
+	case "zones":
+		if method == http.MethodPatch && len(segments) == 4 && segments[3] != "" {
+			return "rrsets"
+		}
+		return "zones"
+	case "search-data":
+		return "search"
+	case "statistics":
+		return "statistics"
+	default:
+		return "other"
+	}
+}
+
+// observe records an upstream call. A non-nil err is counted under the same
+// outcome mapProxyError reports to the client.
+func (m *proxyMetrics) observe(cfg pdnsConfig, method, path string, status int, err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+
+	labels := requestLabels{backend: cfg.Name, method: method, endpoint: endpointClass(method, path), status: strconv.Itoa(status)}
+	if err != nil {
+		labels.status = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.requests[labels]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.requests[labels] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+
+	if err != nil {
+		m.errors[errorLabels{backend: cfg.Name, reason: proxyErrorReason(err)}]++
+	}
+}
+
+// metricsSource renders metric families in the Prometheus text format.
+type metricsSource interface {
+	write(w io.Writer)
+}
+
+func handleMetrics(sources ...metricsSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, source := range sources {
+			source.write(w)
+		}
+	}
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+func (m *proxyMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := slices.SortedFunc(maps.Keys(m.requests), compareRequestLabels)
+
+	fmt.Fprintln(w, "# HELP pdns_webui_proxy_requests_total PowerDNS API requests by upstream status code.")
+	fmt.Fprintln(w, "# TYPE pdns_webui_proxy_requests_total counter")
+	for _, labels := range requests {
+		fmt.Fprintf(w, "pdns_webui_proxy_requests_total{%s} %d\n", labels, m.requests[labels].count)
+	}
+
+	fmt.Fprintln(w, "# HELP pdns_webui_proxy_request_duration_seconds Latency of PowerDNS API requests.")
+	fmt.Fprintln(w, "# TYPE pdns_webui_proxy_request_duration_seconds histogram")
+	for _, labels := range requests {
+		h := m.requests[labels]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "pdns_webui_proxy_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, formatFloat(bound), h.buckets[i])
+		}
+		fmt.Fprintf(w, "pdns_webui_proxy_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "pdns_webui_proxy_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "pdns_webui_proxy_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP pdns_webui_proxy_errors_total PowerDNS API requests that failed without a response.")
+	fmt.Fprintln(w, "# TYPE pdns_webui_proxy_errors_total counter")
+	failures := slices.SortedFunc(maps.Keys(m.errors), func(a, b errorLabels) int {
+		return strings.Compare(a.backend+"\x00"+a.reason, b.backend+"\x00"+b.reason)
+	})
+	for _, labels := range failures {
+		fmt.Fprintf(w, "pdns_webui_proxy_errors_total{backend=%q,reason=%q} %d\n", labels.backend, labels.reason, m.errors[labels])
+	}
+
+	fmt.Fprintln(w, "# HELP pdns_webui_start_time_seconds Start time of the process since the Unix epoch.")
+	fmt.Fprintln(w, "# TYPE pdns_webui_start_time_seconds gauge")
+	fmt.Fprintf(w, "pdns_webui_start_time_seconds %d\n", m.startTime.Unix())
+}
+
+func (l requestLabels) String() string {
+	return fmt.Sprintf("backend=%q,method=%q,endpoint=%q,status=%q", l.backend, l.method, l.endpoint, l.status)
+}
+
+func compareRequestLabels(a, b requestLabels) int {
+	return strings.Compare(a.String(), b.String())
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
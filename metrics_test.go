@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ─── endpointClass ───────────────────────────────────────────────────────────
+
+func TestEndpointClass(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "servers", "servers"},
+		{http.MethodGet, "servers/localhost", "servers"},
+		{http.MethodGet, "servers/localhost/zones", "zones"},
+		{http.MethodGet, "servers/localhost/zones/example.org.", "zones"},
+		{http.MethodPatch, "servers/localhost/zones/example.org.", "rrsets"},
+		{http.MethodPut, "servers/localhost/zones/example.org./notify", "zones"},
+		{http.MethodGet, "servers/localhost/search-data", "search"},
+		{http.MethodGet, "servers/localhost/statistics", "statistics"},
+		{http.MethodGet, "servers/localhost/config", "other"},
+		{http.MethodGet, "version", "other"},
+	}
+	for _, tt := range tests {
+		if got := endpointClass(tt.method, tt.path); got != tt.want {
+			t.Errorf("endpointClass(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// ─── proxyMetrics ────────────────────────────────────────────────────────────
+
+func TestProxyMetrics_CountsProxiedRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			writeError(w, http.StatusUnprocessableEntity, "bad rrset")
+			return
+		}
+		writeJSON(w, http.StatusOK, []any{})
+	}))
+	defer backend.Close()
+
+	metrics := newProxyMetrics()
+	proxy := newTestProxy(backend.URL)
+	proxy.metrics = metrics
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil),
+		httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil),
+		httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{"rrsets":[]}`)),
+	} {
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrapeMetrics(t, metrics)
+	for _, want := range []string{
+		`pdns_webui_proxy_requests_total{backend="main",method="GET",endpoint="zones",status="200"} 2`,
+		`pdns_webui_proxy_requests_total{backend="main",method="PATCH",endpoint="rrsets",status="422"} 1`,
+		`pdns_webui_proxy_request_duration_seconds_bucket{backend="main",method="GET",endpoint="zones",status="200",le="+Inf"} 2`,
+		`pdns_webui_proxy_request_duration_seconds_count{backend="main",method="PATCH",endpoint="rrsets",status="422"} 1`,
+		"# TYPE pdns_webui_proxy_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestProxyMetrics_CountsConnectErrors(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	addr := backend.URL
+	backend.Close()
+
+	metrics := newProxyMetrics()
+	proxy := newTestProxy(addr)
+	proxy.metrics = metrics
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/statistics", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+
+	body := scrapeMetrics(t, metrics)
+	for _, want := range []string{
+		`pdns_webui_proxy_errors_total{backend="main",reason="connect_refused"} 1`,
+		`pdns_webui_proxy_requests_total{backend="main",method="GET",endpoint="statistics",status="error"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestProxyMetrics_HistogramBuckets(t *testing.T) {
+	metrics := newProxyMetrics()
+	cfg := pdnsConfig{Name: "main"}
+	metrics.observe(cfg, http.MethodGet, "servers/localhost/zones", http.StatusOK, nil, 30*time.Millisecond)
+	metrics.observe(cfg, http.MethodGet, "servers/localhost/zones", http.StatusOK, nil, 2*time.Second)
+
+	body := scrapeMetrics(t, metrics)
+	labels := `backend="main",method="GET",endpoint="zones",status="200"`
+	for _, want := range []string{
+		`pdns_webui_proxy_request_duration_seconds_bucket{` + labels + `,le="0.025"} 0`,
+		`pdns_webui_proxy_request_duration_seconds_bucket{` + labels + `,le="0.05"} 1`,
+		`pdns_webui_proxy_request_duration_seconds_bucket{` + labels + `,le="2.5"} 2`,
+		`pdns_webui_proxy_request_duration_seconds_sum{` + labels + `} 2.03`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestProxyErrorReason(t *testing.T) {
+	if got := proxyErrorReason(fakeTimeoutError{}); got != "timeout" {
+		t.Errorf("timeout reason = %q", got)
+	}
+	if got := proxyErrorReason(http.ErrBodyNotAllowed); got != "other" {
+		t.Errorf("other reason = %q", got)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+func scrapeMetrics(t *testing.T, metrics *proxyMetrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleMetrics(metrics)(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return w.Body.String()
+}
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcLoginPath    = "/auth/oidc/login"
+	oidcCallbackPath = "/auth/oidc/callback"
+
+	// oidcStateCookieName binds a login to the browser that started it, so a
+	// callback URL with someone else's code cannot log the victim in.
+	oidcStateCookieName = "pdns_webui_oidc_state"
+
+	oidcPendingTTL = 10 * time.Minute
+	oidcClockSkew  = time.Minute
+	oidcJWKSMaxAge = time.Hour
+	// oidcJWKSRefetchInterval limits how often a token with an unknown kid
+	// makes the keys be fetched again.
+	oidcJWKSRefetchInterval = time.Minute
+)
+
+type oidcConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	GroupMap      map[string]string
+	AllowedGroups []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPending struct {
+	verifier string
+	nonce    string
+	next     string
+	expires  time.Time
+}
+
+type oidcProvider struct {
+	cfg    oidcConfig
+	client *http.Client
+	auth   *authenticator
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	// keysRequested is when the last key fetch started.
+	keysRequested time.Time
+	pending       map[string]oidcPending
+}
+
+func getOIDCConfig() (oidcConfig, error) {
+	clientSecret, err := getSecret("OIDC_CLIENT_SECRET", "")
+	if err != nil {
+		return oidcConfig{}, fmt.Errorf("read OIDC_CLIENT_SECRET_FILE: %w", err)
+	}
+	return oidcConfig{
+		IssuerURL:     strings.TrimRight(getEnv("OIDC_ISSUER_URL", ""), "/"),
+		ClientID:      getEnv("OIDC_CLIENT_ID", ""),
+		ClientSecret:  clientSecret,
+		RedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+		Scopes:        splitList(getEnv("OIDC_SCOPES", "openid profile email")),
+		UsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		GroupsClaim:   getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		GroupMap:      parseGroupMap(getEnv("OIDC_GROUP_MAP", "")),
+		AllowedGroups: splitList(getEnv("OIDC_ALLOWED_GROUPS", "")),
+	}, nil
+}
+
+// parseGroupMap parses "idp-group=local-group,..." pairs used to translate
+// IdP group identifiers into the names used by the UI.
+func parseGroupMap(value string) map[string]string {
+	groupMap := make(map[string]string)
+	for _, pair := range splitList(value) {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			log.Printf("ignoring invalid OIDC group mapping %q", pair)
+			continue
+		}
+		groupMap[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return groupMap
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func newOIDCProvider(cfg oidcConfig, client *http.Client, auth *authenticator) (*oidcProvider, error) {
+	switch {
+	case cfg.ClientID == "":
+		return nil, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+	case cfg.RedirectURL == "":
+		return nil, errors.New("OIDC_REDIRECT_URL is required when OIDC_ISSUER_URL is set")
+	case !slices.Contains(cfg.Scopes, "openid"):
+		return nil, errors.New("OIDC_SCOPES must include openid")
+	}
+
+	return &oidcProvider{
+		cfg:     cfg,
+		client:  client,
+		auth:    auth,
+		pending: make(map[string]oidcPending),
+	}, nil
+}
+
+func (p *oidcProvider) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	discovery, err := p.getDiscovery(r.Context())
+	if err != nil {
+		log.Printf("oidc discovery failed: %v", err)
+		p.auth.renderLogin(w, http.StatusBadGateway, r.URL.Query().Get("next"), "Single sign-on provider is unavailable")
+		return
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	for key, pending := range p.pending {
+		if now.After(pending.expires) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[state] = oidcPending{
+		verifier: verifier,
+		nonce:    nonce,
+		next:     safeRedirectTarget(r.URL.Query().Get("next")),
+		expires:  now.Add(oidcPendingTTL),
+	}
+	p.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     oidcCallbackPath,
+		MaxAge:   int(oidcPendingTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   p.auth.cfg.CookieSecure || r.TLS != nil,
+		// Lax still sends the cookie on the top-level redirect from the IdP.
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	target := discovery.AuthorizationEndpoint
+	if strings.Contains(target, "?") {
+		target += "&" + query.Encode()
+	} else {
+		target += "?" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (p *oidcProvider) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		log.Printf("oidc provider returned error %q: %s", errCode, query.Get("error_description"))
+		p.auth.renderLogin(w, http.StatusUnauthorized, "", "Single sign-on was rejected by the provider")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     oidcCallbackPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   p.auth.cfg.CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Printf("oidc callback from %s does not match the sign-in started by this browser", r.RemoteAddr)
+		p.auth.renderLogin(w, http.StatusBadRequest, "", "Sign-in attempt expired, please try again")
+		return
+	}
+
+	p.mu.Lock()
+	pending, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		p.auth.renderLogin(w, http.StatusBadRequest, "", "Sign-in attempt expired, please try again")
+		return
+	}
+
+	id, err := p.exchange(r.Context(), query.Get("code"), pending)
+	if err != nil {
+		log.Printf("oidc login failed from %s: %v", r.RemoteAddr, err)
+		p.auth.renderLogin(w, http.StatusUnauthorized, pending.next, "Single sign-on failed")
+		return
+	}
+
+	if len(p.cfg.AllowedGroups) > 0 && !slices.ContainsFunc(id.Groups, func(g string) bool {
+		return slices.Contains(p.cfg.AllowedGroups, g)
+	}) {
+		log.Printf("oidc user %q is not in any allowed group", id.User)
+		p.auth.renderLogin(w, http.StatusForbidden, pending.next, "Your account is not allowed to use this application")
+		return
+	}
+
+	token, err := p.auth.createSession(id)
+	if err != nil {
+		log.Printf("failed to create session: %v", err)
+		p.auth.renderLogin(w, http.StatusInternalServerError, pending.next, "Could not create session")
+		return
+	}
+
+	log.Printf("user %q logged in via oidc from %s", id.User, r.RemoteAddr)
+	p.auth.setSessionCookie(w, r, token)
+	http.Redirect(w, r, pending.next, http.StatusSeeOther)
+}
+
+func (p *oidcProvider) exchange(ctx context.Context, code string, pending oidcPending) (identity, error) {
+	if code == "" {
+		return identity{}, errors.New("missing authorization code")
+	}
+
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {pending.verifier},
+		"client_id":     {p.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return identity{}, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return identity{}, fmt.Errorf("read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return identity{}, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return identity{}, fmt.Errorf("decode token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return identity{}, errors.New("token response does not contain id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, tokens.IDToken, pending.nonce)
+	if err != nil {
+		return identity{}, err
+	}
+
+	return p.identityFromClaims(claims)
+}
+
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawToken, nonce string) (map[string]any, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("id_token is not a JWS compact token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("decode id_token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode id_token signature: %w", err)
+	}
+
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("decode id_token claims: %w", err)
+	}
+
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != discovery.Issuer {
+		return nil, fmt.Errorf("id_token issuer %q does not match %q", iss, discovery.Issuer)
+	}
+
+	audiences := claimStrings(claims["aud"])
+	if !slices.Contains(audiences, p.cfg.ClientID) {
+		return nil, fmt.Errorf("id_token audience %v does not include client id", audiences)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, fmt.Errorf("id_token authorized party %q does not match client id", azp)
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("id_token has no exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, errors.New("id_token has expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(oidcClockSkew)) {
+		return nil, errors.New("id_token was issued in the future")
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func (p *oidcProvider) identityFromClaims(claims map[string]any) (identity, error) {
+	user, _ := lookupClaim(claims, p.cfg.UsernameClaim).(string)
+	if user == "" {
+		user, _ = claims["email"].(string)
+	}
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	if user == "" {
+		return identity{}, errors.New("id_token does not identify the user")
+	}
+
+	var groups []string
+	for _, group := range claimStrings(lookupClaim(claims, p.cfg.GroupsClaim)) {
+		if mapped, ok := p.cfg.GroupMap[group]; ok {
+			group = mapped
+		}
+		if !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+
+	return identity{User: user, Groups: groups, Source: "oidc"}, nil
+}
+
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	discovery = &oidcDiscovery{}
+	if err := p.fetchJSON(ctx, p.cfg.IssuerURL+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("fetch discovery document: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, p.cfg.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.mu.Lock()
+	p.discovery = discovery
+	p.mu.Unlock()
+	return discovery, nil
+}
+
+func (p *oidcProvider) getKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	fresh := time.Since(p.keysFetched) < oidcJWKSMaxAge
+	if ok && fresh {
+		p.mu.Unlock()
+		return key, nil
+	}
+	// An unknown kid may be a rotated key, but anyone can send a token with
+	// one, so the keys are fetched again at most once per interval.
+	if fresh && time.Since(p.keysRequested) < oidcJWKSRefetchInterval {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no signing key with kid %q", kid)
+	}
+	p.keysRequested = time.Now()
+	p.mu.Unlock()
+
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.fetchJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("skipping jwk %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no signing key with kid %q", kid)
+	}
+	return key, nil
+}
+
+func (p *oidcProvider) fetchJSON(ctx context.Context, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	var curve elliptic.Curve
+	switch alg {
+	case "RS256", "ES256", "PS256":
+		hash, curve = crypto.SHA256, elliptic.P256()
+	case "RS384", "ES384", "PS384":
+		hash, curve = crypto.SHA384, elliptic.P384()
+	case "RS512", "ES512", "PS512":
+		hash, curve = crypto.SHA512, elliptic.P521()
+	default:
+		return fmt.Errorf("unsupported id_token algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		if err != nil {
+			return errors.New("id_token signature is invalid")
+		}
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		if ecKey.Curve != curve {
+			return fmt.Errorf("key curve %s does not match algorithm %s", ecKey.Curve.Params().Name, alg)
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("id_token signature has invalid length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("id_token signature is invalid")
+		}
+	}
+
+	return nil
+}
+
+func decodeJWTSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// lookupClaim resolves dotted claim names such as "realm_access.roles".
+func lookupClaim(claims map[string]any, name string) any {
+	if value, ok := claims[name]; ok {
+		return value
+	}
+
+	var current any = claims
+	for part := range strings.SplitSeq(name, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
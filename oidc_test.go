@@ -0,0 +1,469 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ─── getOIDCConfig ────────────────────────────────────────────────────────────
+
+func TestGetOIDCConfig_ParsesEnv(t *testing.T) {
+	t.Setenv("OIDC_ISSUER_URL", "https://idp.example.com/")
+	t.Setenv("OIDC_CLIENT_ID", "pdns")
+	t.Setenv("OIDC_SCOPES", "openid,email groups")
+	t.Setenv("OIDC_GROUP_MAP", "g-123=dns-admins, g-456=noc")
+
+	cfg, err := getOIDCConfig()
+	if err != nil {
+		t.Fatalf("getOIDCConfig: %v", err)
+	}
+
+	if cfg.IssuerURL != "https://idp.example.com" {
+		t.Errorf("IssuerURL = %q, want trailing slash trimmed", cfg.IssuerURL)
+	}
+	if !slices.Equal(cfg.Scopes, []string{"openid", "email", "groups"}) {
+		t.Errorf("Scopes = %v", cfg.Scopes)
+	}
+	if cfg.GroupMap["g-123"] != "dns-admins" || cfg.GroupMap["g-456"] != "noc" {
+		t.Errorf("GroupMap = %v", cfg.GroupMap)
+	}
+	if cfg.GroupsClaim != "groups" {
+		t.Errorf("GroupsClaim = %q, want %q", cfg.GroupsClaim, "groups")
+	}
+}
+
+func TestGetOIDCConfig_UnreadableSecretFile(t *testing.T) {
+	t.Setenv("OIDC_CLIENT_SECRET", "")
+	t.Setenv("OIDC_CLIENT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := getOIDCConfig(); err == nil || !strings.Contains(err.Error(), "OIDC_CLIENT_SECRET_FILE") {
+		t.Errorf("error = %v, want OIDC_CLIENT_SECRET_FILE read error", err)
+	}
+}
+
+func TestNewOIDCProvider_RequiresClientAndRedirect(t *testing.T) {
+	for name, cfg := range map[string]oidcConfig{
+		"no client id":    {IssuerURL: "https://idp", RedirectURL: "https://ui/cb", Scopes: []string{"openid"}},
+		"no redirect url": {IssuerURL: "https://idp", ClientID: "pdns", Scopes: []string{"openid"}},
+		"no openid scope": {IssuerURL: "https://idp", ClientID: "pdns", RedirectURL: "https://ui/cb", Scopes: []string{"email"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newOIDCProvider(cfg, http.DefaultClient, nil); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+// ─── авторизационный поток против тестового issuer ───────────────────────────
+
+func TestOIDCLogin_RedirectsWithPKCE(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+
+	req := httptest.NewRequest(http.MethodGet, oidcLoginPath+"?next=/zones", nil)
+	w := httptest.NewRecorder()
+	provider.handleLogin(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), issuer.URL+"/authorize") {
+		t.Errorf("Location = %q, want authorization endpoint", location)
+	}
+
+	query := location.Query()
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(param) == "" {
+			t.Errorf("%s parameter missing", param)
+		}
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+	if query.Get("client_id") != "pdns-webui" {
+		t.Errorf("client_id = %q", query.Get("client_id"))
+	}
+}
+
+func TestOIDCCallback_CreatesSessionWithMappedGroups(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.claims["groups"] = []string{"g-web", "other"}
+	provider := newTestOIDCProvider(t, issuer)
+	provider.cfg.GroupMap = map[string]string{"g-web": "web-team"}
+
+	w := completeOIDCLogin(t, provider, issuer)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d, body=%s", w.Code, http.StatusSeeOther, w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != "/zones" {
+		t.Errorf("Location = %q, want %q", got, "/zones")
+	}
+
+	cookie := findCookie(w.Result().Cookies(), sessionCookieName)
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+	id, ok := provider.auth.lookupSession(cookie.Value)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if id.User != "alice" || id.Source != "oidc" {
+		t.Errorf("identity = %+v", id)
+	}
+	if !slices.Equal(id.Groups, []string{"web-team", "other"}) {
+		t.Errorf("groups = %v, want [web-team other]", id.Groups)
+	}
+	if issuer.lastVerifier == "" {
+		t.Error("token request did not include code_verifier")
+	}
+}
+
+func TestOIDCCallback_RejectsInvalidTokens(t *testing.T) {
+	for name, mutate := range map[string]func(*testIssuer){
+		"wrong audience": func(i *testIssuer) { i.claims["aud"] = "someone-else" },
+		"expired":        func(i *testIssuer) { i.claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"wrong issuer":   func(i *testIssuer) { i.claims["iss"] = "https://evil.example" },
+		"wrong nonce":    func(i *testIssuer) { i.overrideNonce = "forged" },
+		"bad signature":  func(i *testIssuer) { i.corruptSignature = true },
+		"unsigned":       func(i *testIssuer) { i.alg = "none" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			issuer := newTestIssuer(t)
+			mutate(issuer)
+			provider := newTestOIDCProvider(t, issuer)
+
+			w := completeOIDCLogin(t, provider, issuer)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if findCookie(w.Result().Cookies(), sessionCookieName) != nil {
+				t.Error("session cookie must not be set")
+			}
+		})
+	}
+}
+
+func TestOIDCCallback_DisallowedGroup_Returns403(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.claims["groups"] = []string{"guests"}
+	provider := newTestOIDCProvider(t, issuer)
+	provider.cfg.AllowedGroups = []string{"dns-admins"}
+
+	w := completeOIDCLogin(t, provider, issuer)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestOIDCCallback_UnknownState_Returns400(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+
+	req := httptest.NewRequest(http.MethodGet, oidcCallbackPath+"?code=abc&state=unknown", nil)
+	w := httptest.NewRecorder()
+	provider.handleCallback(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCCallback_StateIsSingleUse(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+
+	state, cookie := startOIDCLogin(t, provider, issuer)
+	callback := oidcCallbackPath + "?code=" + issuer.code + "&state=" + url.QueryEscape(state)
+
+	first := httptest.NewRecorder()
+	provider.handleCallback(first, newOIDCCallbackRequest(callback, cookie))
+	if first.Code != http.StatusSeeOther {
+		t.Fatalf("first callback status = %d, want %d", first.Code, http.StatusSeeOther)
+	}
+
+	second := httptest.NewRecorder()
+	provider.handleCallback(second, newOIDCCallbackRequest(callback, cookie))
+	if second.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback status = %d, want %d", second.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCCallback_StateFromAnotherBrowser_Returns400(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+
+	// The attacker starts a login and sends the victim the callback URL; the
+	// victim's browser has no state cookie, or one of its own login.
+	state, _ := startOIDCLogin(t, provider, issuer)
+	_, victimCookie := startOIDCLogin(t, provider, issuer)
+	callback := oidcCallbackPath + "?code=" + issuer.code + "&state=" + url.QueryEscape(state)
+
+	for name, cookie := range map[string]*http.Cookie{"no cookie": nil, "other login": victimCookie} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			provider.handleCallback(w, newOIDCCallbackRequest(callback, cookie))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if findCookie(w.Result().Cookies(), sessionCookieName) != nil {
+				t.Error("session cookie must not be set")
+			}
+		})
+	}
+}
+
+// ─── lookupClaim ─────────────────────────────────────────────────────────────
+
+func TestOIDCProvider_ThrottlesJWKSRefetchForUnknownKid(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+
+	if _, err := provider.getKey(t.Context(), "test-key"); err != nil {
+		t.Fatalf("getKey: %v", err)
+	}
+	for range 3 {
+		if _, err := provider.getKey(t.Context(), "forged-key"); err == nil {
+			t.Fatal("getKey succeeded for an unknown kid")
+		}
+	}
+	if got := issuer.jwksFetches.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want unknown kids not to refetch within a minute", got)
+	}
+
+	provider.keysRequested = time.Now().Add(-oidcJWKSRefetchInterval)
+	provider.getKey(t.Context(), "forged-key")
+	if got := issuer.jwksFetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want a refetch once the interval passed", got)
+	}
+}
+
+func TestVerifyJWTSignature_RejectsCurveMismatch(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signed := []byte("header.payload")
+	digest := sha256.Sum256(signed)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...)
+
+	if err := verifyJWTSignature("ES256", &key.PublicKey, signed, signature); err == nil || !strings.Contains(err.Error(), "curve") {
+		t.Errorf("verifyJWTSignature = %v, want a P-384 key rejected for ES256", err)
+	}
+}
+
+func TestLookupClaim_NestedPath(t *testing.T) {
+	claims := map[string]any{
+		"realm_access": map[string]any{"roles": []any{"admin", "viewer"}},
+	}
+
+	got := claimStrings(lookupClaim(claims, "realm_access.roles"))
+	if !slices.Equal(got, []string{"admin", "viewer"}) {
+		t.Errorf("roles = %v", got)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+// testIssuer — минимальный OIDC-провайдер на httptest: discovery, JWKS и token endpoint.
+type testIssuer struct {
+	*httptest.Server
+	key              *rsa.PrivateKey
+	code             string
+	claims           map[string]any
+	alg              string
+	overrideNonce    string
+	corruptSignature bool
+	lastVerifier     string
+	challenges       map[string]string
+	jwksFetches      atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	issuer := &testIssuer{
+		key:        key,
+		code:       "test-code",
+		alg:        "RS256",
+		challenges: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksFetches.Add(1)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != issuer.code {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		issuer.lastVerifier = r.PostForm.Get("code_verifier")
+		sum := sha256.Sum256([]byte(issuer.lastVerifier))
+		nonce, ok := issuer.challenges[base64.RawURLEncoding.EncodeToString(sum[:])]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "pkce"})
+			return
+		}
+		if issuer.overrideNonce != "" {
+			nonce = issuer.overrideNonce
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     issuer.sign(t, nonce),
+		})
+	})
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	issuer.claims = map[string]any{
+		"iss":                issuer.URL,
+		"sub":                "user-1",
+		"aud":                "pdns-webui",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": "alice",
+	}
+	return issuer
+}
+
+func (i *testIssuer) sign(t *testing.T, nonce string) string {
+	t.Helper()
+
+	claims := make(map[string]any, len(i.claims)+1)
+	for k, v := range i.claims {
+		claims[k] = v
+	}
+	claims["nonce"] = nonce
+
+	header, _ := json.Marshal(map[string]string{"alg": i.alg, "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	if i.alg == "none" {
+		return signed + "."
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	if i.corruptSignature {
+		signature[0] ^= 0xff
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestOIDCProvider(t *testing.T, issuer *testIssuer) *oidcProvider {
+	t.Helper()
+
+	auth := newTestAuthenticator(t)
+	provider, err := newOIDCProvider(oidcConfig{
+		IssuerURL:     issuer.URL,
+		ClientID:      "pdns-webui",
+		ClientSecret:  "s3cret",
+		RedirectURL:   "https://ui.example.com" + oidcCallbackPath,
+		Scopes:        []string{"openid", "profile"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+	}, issuer.Client(), auth)
+	if err != nil {
+		t.Fatalf("newOIDCProvider: %v", err)
+	}
+	auth.oidc = provider
+	return provider
+}
+
+// startOIDCLogin выполняет редирект на IdP и регистрирует PKCE challenge в тестовом issuer,
+// как это сделал бы настоящий провайдер на странице авторизации. Возвращает state
+// и cookie, которую браузер получил вместе с редиректом.
+func startOIDCLogin(t *testing.T, provider *oidcProvider, issuer *testIssuer) (string, *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	provider.handleLogin(w, httptest.NewRequest(http.MethodGet, oidcLoginPath+"?next=/zones", nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+	cookie := findCookie(w.Result().Cookies(), oidcStateCookieName)
+	if cookie == nil {
+		t.Fatal("state cookie not set")
+	}
+
+	query := location.Query()
+	issuer.challenges[query.Get("code_challenge")] = query.Get("nonce")
+	return query.Get("state"), cookie
+}
+
+func completeOIDCLogin(t *testing.T, provider *oidcProvider, issuer *testIssuer) *httptest.ResponseRecorder {
+	t.Helper()
+
+	state, cookie := startOIDCLogin(t, provider, issuer)
+	req := newOIDCCallbackRequest(oidcCallbackPath+"?code="+issuer.code+"&state="+url.QueryEscape(state), cookie)
+	w := httptest.NewRecorder()
+	provider.handleCallback(w, req)
+	return w
+}
+
+func newOIDCCallbackRequest(target string, cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return req
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type proxyAuthConfig struct {
+	TrustedCIDRs []netip.Prefix
+	UserHeader   string
+	GroupsHeader string
+}
+
+func getProxyAuthConfig() (proxyAuthConfig, error) {
+	cfg := proxyAuthConfig{
+		UserHeader:   getEnv("AUTH_PROXY_USER_HEADER", "X-Forwarded-User"),
+		GroupsHeader: getEnv("AUTH_PROXY_GROUPS_HEADER", "X-Forwarded-Groups"),
+	}
+
+	prefixes, err := parseCIDRList(getEnv("AUTH_PROXY_TRUSTED_CIDRS", ""))
+	if err != nil {
+		return proxyAuthConfig{}, fmt.Errorf("AUTH_PROXY_TRUSTED_CIDRS: %w", err)
+	}
+	cfg.TrustedCIDRs = prefixes
+
+	return cfg, nil
+}
+
+// parseCIDRList accepts prefixes and bare addresses, e.g. "10.0.0.0/8, ::1".
+func parseCIDRList(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", item, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func (c proxyAuthConfig) enabled() bool {
+	return len(c.TrustedCIDRs) > 0
+}
+
+func (c proxyAuthConfig) trusts(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range c.TrustedCIDRs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// identityFromHeaders returns the identity asserted by a trusted reverse proxy.
+// Headers sent by any other peer are ignored so they cannot be spoofed.
+func (c proxyAuthConfig) identityFromHeaders(r *http.Request) (identity, bool) {
+	user := strings.TrimSpace(r.Header.Get(c.UserHeader))
+	if user == "" {
+		return identity{}, false
+	}
+
+	if !c.trusts(r.RemoteAddr) {
+		log.Printf("ignoring %s header from untrusted peer %s", c.UserHeader, r.RemoteAddr)
+		return identity{}, false
+	}
+
+	var groups []string
+	for _, value := range r.Header.Values(c.GroupsHeader) {
+		for group := range strings.SplitSeq(value, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	return identity{User: user, Groups: groups, Source: "proxy"}, true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// ─── getProxyAuthConfig ──────────────────────────────────────────────────────
+
+func TestGetProxyAuthConfig_Defaults(t *testing.T) {
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "")
+	t.Setenv("AUTH_PROXY_USER_HEADER", "")
+	t.Setenv("AUTH_PROXY_GROUPS_HEADER", "")
+
+	cfg, err := getProxyAuthConfig()
+	if err != nil {
+		t.Fatalf("getProxyAuthConfig returned error: %v", err)
+	}
+	if cfg.enabled() {
+		t.Error("proxy auth must be disabled without trusted CIDRs")
+	}
+	if cfg.UserHeader != "X-Forwarded-User" || cfg.GroupsHeader != "X-Forwarded-Groups" {
+		t.Errorf("headers = %q, %q", cfg.UserHeader, cfg.GroupsHeader)
+	}
+}
+
+func TestGetProxyAuthConfig_InvalidCIDR(t *testing.T) {
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "10.0.0.0/8, not-an-ip")
+
+	if _, err := getProxyAuthConfig(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestProxyAuthConfig_Trusts(t *testing.T) {
+	prefixes, err := parseCIDRList("10.0.0.0/8, 192.0.2.7, ::1")
+	if err != nil {
+		t.Fatalf("parseCIDRList: %v", err)
+	}
+	cfg := proxyAuthConfig{TrustedCIDRs: prefixes}
+
+	for addr, want := range map[string]bool{
+		"10.1.2.3:5555":          true,
+		"192.0.2.7:80":           true,
+		"192.0.2.8:80":           false,
+		"[::1]:8080":             true,
+		"[::ffff:10.0.0.1]:8080": true,
+		"203.0.113.1:1234":       false,
+		"garbage":                false,
+	} {
+		if got := cfg.trusts(addr); got != want {
+			t.Errorf("trusts(%q) = %t, want %t", addr, got, want)
+		}
+	}
+}
+
+// ─── authenticator.middleware в режиме доверенного прокси ────────────────────
+
+func TestAuthMiddleware_TrustedProxyHeaders_SetIdentity(t *testing.T) {
+	auth := newProxyHeaderAuthenticator(t)
+
+	var got identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = identityFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers", nil)
+	req.RemoteAddr = "10.0.0.5:40000"
+	req.Header.Set("Remote-User", "alice")
+	req.Header.Set("Remote-Groups", "noc, web")
+	w := httptest.NewRecorder()
+	auth.middleware(next).ServeHTTP(w, req)
+
+	if got.User != "alice" || got.Source != "proxy" {
+		t.Errorf("identity = %+v", got)
+	}
+	if !slices.Equal(got.Groups, []string{"noc", "web"}) {
+		t.Errorf("groups = %v, want [noc web]", got.Groups)
+	}
+}
+
+func TestAuthMiddleware_UntrustedProxyHeaders_Ignored(t *testing.T) {
+	auth := newProxyHeaderAuthenticator(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers", nil)
+	req.RemoteAddr = "203.0.113.9:40000"
+	req.Header.Set("Remote-User", "admin")
+	w := httptest.NewRecorder()
+	auth.middleware(okHandler()).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddleware_ProxyOnly_PageWithoutIdentity_Returns401(t *testing.T) {
+	auth := newProxyHeaderAuthenticator(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:40000"
+	w := httptest.NewRecorder()
+	auth.middleware(okHandler()).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d (no login page in proxy-only mode)", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddleware_ProxyIdentity_FeedsPolicy(t *testing.T) {
+	auth := newProxyHeaderAuthenticator(t)
+	proxy := &pdnsProxy{client: newProxyClient(), policy: &accessPolicy{Grants: []accessGrant{
+		{Groups: []string{"noc"}, Role: roleViewer},
+	}}}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/pdns/servers/localhost/zones/example.com.", nil)
+	req.RemoteAddr = "10.0.0.5:40000"
+	req.Header.Set("Remote-User", "nick")
+	req.Header.Set("Remote-Groups", "noc")
+	w := httptest.NewRecorder()
+	auth.middleware(proxy).ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+// newProxyHeaderAuthenticator настраивает режим Authelia-подобных заголовков Remote-User/Remote-Groups.
+func newProxyHeaderAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+
+	prefixes, err := parseCIDRList("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parseCIDRList: %v", err)
+	}
+
+	auth, err := newAuthenticator(authConfig{}, mustParseTemplate(t))
+	if err != nil {
+		t.Fatalf("newAuthenticator: %v", err)
+	}
+	auth.proxyAuth = proxyAuthConfig{
+		TrustedCIDRs: prefixes,
+		UserHeader:   "Remote-User",
+		GroupsHeader: "Remote-Groups",
+	}
+	return auth
+}
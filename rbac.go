@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+type role string
+
+const (
+	roleViewer role = "viewer"
+	roleEditor role = "editor"
+	roleAdmin  role = "admin"
+)
+
+type accessGrant struct {
+	Users   []string `json:"users" yaml:"users"`
+	Groups  []string `json:"groups" yaml:"groups"`
+	Role    role     `json:"role" yaml:"role"`
+	Zones   []string `json:"zones" yaml:"zones"`
+	Methods []string `json:"methods" yaml:"methods"`
+}
+
+type accessPolicy struct {
+	DefaultRole role           `json:"default_role" yaml:"default_role"`
+	Grants      []accessGrant  `json:"grants" yaml:"grants"`
+	Endpoints   endpointPolicy `json:"endpoints" yaml:"endpoints"`
+}
+
+// proxyTarget is the PowerDNS resource addressed by a proxied request path.
+type proxyTarget struct {
+	ServerID string
+	// Resource is the segment below servers/{id}, such as "zones" or
+	// "search-data".
+	Resource string
+	Zone     string
+	Sub      string
+}
+
+var errForbiddenPath = errors.New("path traversal is not allowed")
+
+// loadPolicyConfig returns the policy from AUTH_POLICY_FILE, or else the inline
+// policy of the config file. A nil policy gives every user full access.
+func loadPolicyConfig(fileCfg *fileConfig) (*accessPolicy, error) {
+	if path := getEnv("AUTH_POLICY_FILE", ""); path != "" {
+		return loadAccessPolicy(path)
+	}
+	if fileCfg != nil {
+		return fileCfg.Policy, nil
+	}
+	return nil, nil
+}
+
+func loadAccessPolicy(path string) (*accessPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+
+	var policy accessPolicy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("parse policy file %s: %w", path, err)
+	}
+	if err := policy.normalize(); err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+func (p *accessPolicy) normalize() error {
+	if p.DefaultRole != "" && !p.DefaultRole.valid() {
+		return fmt.Errorf("default_role: unknown role %q", p.DefaultRole)
+	}
+
+	for i := range p.Grants {
+		grant := &p.Grants[i]
+		if !grant.Role.valid() {
+			return fmt.Errorf("grants[%d].role: unknown role %q", i, grant.Role)
+		}
+		if len(grant.Users) == 0 && len(grant.Groups) == 0 {
+			return fmt.Errorf("grants[%d]: at least one of users or groups is required", i)
+		}
+		for j, zone := range grant.Zones {
+			if strings.TrimSpace(zone) == "" {
+				return fmt.Errorf("grants[%d].zones[%d]: empty zone name", i, j)
+			}
+			grant.Zones[j] = canonicalZone(zone)
+		}
+		for j, method := range grant.Methods {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if !allowedProxyMethods[method] {
+				return fmt.Errorf("grants[%d].methods[%d]: unsupported method %q", i, j, method)
+			}
+			grant.Methods[j] = method
+		}
+	}
+
+	return p.Endpoints.normalize()
+}
+
+func (r role) valid() bool {
+	return r == roleViewer || r == roleEditor || r == roleAdmin
+}
+
+func (r role) allows(method string, target proxyTarget) bool {
+	switch r {
+	case roleAdmin:
+		return true
+	case roleEditor:
+		if method == http.MethodGet {
+			return true
+		}
+		// Editors change the contents of existing zones but cannot create or delete zones.
+		return target.Zone != "" && !(method == http.MethodDelete && target.Sub == "")
+	case roleViewer:
+		return method == http.MethodGet
+	default:
+		return false
+	}
+}
+
+// authorize returns nil when at least one grant matching the identity, or the
+// default role, permits the call.
+func (p *accessPolicy) authorize(id identity, method string, target proxyTarget) error {
+	for _, grant := range p.Grants {
+		if grant.matches(id) && grant.allows(method, target) {
+			return nil
+		}
+	}
+
+	if p.DefaultRole != "" && p.DefaultRole.allows(method, target) {
+		return nil
+	}
+
+	subject := id.User
+	if subject == "" {
+		subject = "anonymous"
+	}
+	if target.Zone != "" {
+		return fmt.Errorf("user %q is not allowed to %s zone %s", subject, method, target.Zone)
+	}
+	return fmt.Errorf("user %q is not allowed to %s this resource", subject, method)
+}
+
+// isAdmin reports whether the identity holds an admin grant that is not
+// limited to particular zones or methods.
+func (p *accessPolicy) isAdmin(id identity) bool {
+	if p.DefaultRole == roleAdmin {
+		return true
+	}
+	return slices.ContainsFunc(p.Grants, func(g accessGrant) bool {
+		return g.Role == roleAdmin && len(g.Zones) == 0 && len(g.Methods) == 0 && g.matches(id)
+	})
+}
+
+func (g accessGrant) matches(id identity) bool {
+	if id.User != "" && (slices.Contains(g.Users, id.User) || slices.Contains(g.Users, "*")) {
+		return true
+	}
+	return slices.ContainsFunc(id.Groups, func(group string) bool {
+		return slices.Contains(g.Groups, group)
+	})
+}
+
+func (g accessGrant) allows(method string, target proxyTarget) bool {
+	if len(g.Methods) > 0 && method != http.MethodGet && !slices.Contains(g.Methods, method) {
+		return false
+	}
+	if len(g.Zones) > 0 {
+		if target.Zone == "" {
+			// Zone-scoped grants may still list servers and zones, but not
+			// search or read statistics, which span every zone.
+			return method == http.MethodGet && (target.Resource == "" || target.Resource == "zones")
+		}
+		if !slices.ContainsFunc(g.Zones, func(pattern string) bool { return zoneMatches(pattern, target.Zone) }) {
+			return false
+		}
+	}
+	return g.Role.allows(method, target)
+}
+
+// zoneMatches supports exact zone names and "*.example.com." for all zones
+// below example.com.
+func zoneMatches(pattern, zone string) bool {
+	if pattern == "*" || pattern == zone {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(zone, "."+suffix)
+	}
+	return false
+}
+
+func canonicalZone(zone string) string {
+	zone = strings.ToLower(strings.TrimSpace(zone))
+	if zone != "*" && !strings.HasSuffix(zone, ".") {
+		zone += "."
+	}
+	return zone
+}
+
+// parseProxyTarget extracts server and zone from an escaped proxy path such as
+// "servers/localhost/zones/example.com./export".
+func parseProxyTarget(escapedPath string) (proxyTarget, error) {
+	segments := strings.Split(escapedPath, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return proxyTarget{}, fmt.Errorf("invalid path segment %q: %w", segment, err)
+		}
+		for part := range strings.SplitSeq(unescaped, "/") {
+			if part == "." || part == ".." {
+				return proxyTarget{}, errForbiddenPath
+			}
+		}
+		segments[i] = unescaped
+	}
+
+	var target proxyTarget
+	if len(segments) >= 2 && segments[0] == "servers" {
+		target.ServerID = segments[1]
+	}
+	if len(segments) >= 3 && segments[0] == "servers" {
+		target.Resource = segments[2]
+	}
+	if len(segments) >= 4 && segments[0] == "servers" && segments[2] == "zones" && segments[3] != "" {
+		target.Zone = canonicalZone(segments[3])
+		target.Sub = strings.Join(segments[4:], "/")
+	}
+
+	return target, nil
+}
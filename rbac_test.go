@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ─── parseProxyTarget ────────────────────────────────────────────────────────
+
+func TestParseProxyTarget(t *testing.T) {
+	for path, want := range map[string]proxyTarget{
+		"servers":                                     {},
+		"servers/localhost":                           {ServerID: "localhost"},
+		"servers/localhost/zones":                     {ServerID: "localhost", Resource: "zones"},
+		"servers/localhost/search-data":               {ServerID: "localhost", Resource: "search-data"},
+		"servers/localhost/zones/example.com.":        {ServerID: "localhost", Resource: "zones", Zone: "example.com."},
+		"servers/localhost/zones/Example.COM":         {ServerID: "localhost", Resource: "zones", Zone: "example.com."},
+		"servers/localhost/zones/example.com./export": {ServerID: "localhost", Resource: "zones", Zone: "example.com.", Sub: "export"},
+		"servers/localhost/zones/example.com./metadata/ALLOW-AXFR-FROM": {
+			ServerID: "localhost", Resource: "zones", Zone: "example.com.", Sub: "metadata/ALLOW-AXFR-FROM",
+		},
+	} {
+		t.Run(path, func(t *testing.T) {
+			got, err := parseProxyTarget(path)
+			if err != nil {
+				t.Fatalf("parseProxyTarget returned error: %v", err)
+			}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseProxyTarget_RejectsTraversal(t *testing.T) {
+	for _, path := range []string{
+		"servers/localhost/zones/../config",
+		"servers/localhost/zones/%2e%2e/config",
+		"servers/localhost/zones/x%2F..%2Fconfig",
+	} {
+		t.Run(path, func(t *testing.T) {
+			if _, err := parseProxyTarget(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// ─── accessPolicy.authorize ──────────────────────────────────────────────────
+
+func TestAccessPolicy_Authorize(t *testing.T) {
+	policy := &accessPolicy{Grants: []accessGrant{
+		{Groups: []string{"web"}, Role: roleEditor, Zones: []string{"example.com"}, Methods: []string{"patch"}},
+		{Groups: []string{"noc"}, Role: roleViewer},
+		{Users: []string{"root"}, Role: roleAdmin},
+		{Groups: []string{"hosting"}, Role: roleEditor, Zones: []string{"*.customers.net"}},
+	}}
+	if err := policy.normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+
+	web := identity{User: "wanda", Groups: []string{"web"}}
+	noc := identity{User: "nick", Groups: []string{"noc"}}
+	root := identity{User: "root"}
+	hosting := identity{User: "hank", Groups: []string{"hosting"}}
+	stranger := identity{User: "sam"}
+
+	zone := func(name, sub string) proxyTarget {
+		return proxyTarget{ServerID: "localhost", Resource: "zones", Zone: name, Sub: sub}
+	}
+	server := proxyTarget{ServerID: "localhost"}
+	zonesList := proxyTarget{ServerID: "localhost", Resource: "zones"}
+	search := proxyTarget{ServerID: "localhost", Resource: "search-data"}
+	statistics := proxyTarget{ServerID: "localhost", Resource: "statistics"}
+
+	for _, tc := range []struct {
+		name   string
+		id     identity
+		method string
+		target proxyTarget
+		allow  bool
+	}{
+		{"web patches own zone", web, http.MethodPatch, zone("example.com.", ""), true},
+		{"web reads own zone", web, http.MethodGet, zone("example.com.", ""), true},
+		{"web lists zones", web, http.MethodGet, zonesList, true},
+		{"web reads server", web, http.MethodGet, server, true},
+		{"web cannot search all zones", web, http.MethodGet, search, false},
+		{"web cannot read statistics", web, http.MethodGet, statistics, false},
+		{"noc searches all zones", noc, http.MethodGet, search, true},
+		{"web patches other zone", web, http.MethodPatch, zone("example.org.", ""), false},
+		{"web puts metadata (method not granted)", web, http.MethodPut, zone("example.com.", "metadata/X"), false},
+		{"web creates zone", web, http.MethodPost, zonesList, false},
+		{"noc reads anything", noc, http.MethodGet, zone("example.org.", "export"), true},
+		{"noc cannot patch", noc, http.MethodPatch, zone("example.com.", ""), false},
+		{"root deletes zone", root, http.MethodDelete, zone("example.com.", ""), true},
+		{"root creates zone", root, http.MethodPost, zonesList, true},
+		{"hosting edits subzone", hosting, http.MethodPut, zone("a.customers.net.", "notify"), true},
+		{"hosting cannot delete subzone", hosting, http.MethodDelete, zone("a.customers.net.", ""), false},
+		{"hosting cannot edit parent", hosting, http.MethodPatch, zone("customers.net.", ""), false},
+		{"stranger denied", stranger, http.MethodGet, zonesList, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.authorize(tc.id, tc.method, tc.target)
+			if tc.allow && err != nil {
+				t.Errorf("expected allow, got %v", err)
+			}
+			if !tc.allow && err == nil {
+				t.Error("expected deny")
+			}
+		})
+	}
+}
+
+func TestAccessPolicy_DefaultRole(t *testing.T) {
+	policy := &accessPolicy{DefaultRole: roleViewer}
+
+	if err := policy.authorize(identity{User: "anyone"}, http.MethodGet, proxyTarget{}); err != nil {
+		t.Errorf("GET denied: %v", err)
+	}
+	if err := policy.authorize(identity{User: "anyone"}, http.MethodPost, proxyTarget{}); err == nil {
+		t.Error("POST allowed for default viewer role")
+	}
+}
+
+func TestAccessPolicy_DenyMessageMentionsZone(t *testing.T) {
+	policy := &accessPolicy{}
+
+	err := policy.authorize(identity{User: "bob"}, http.MethodPatch, proxyTarget{Zone: "example.com."})
+	if err == nil || !strings.Contains(err.Error(), "example.com.") || !strings.Contains(err.Error(), "bob") {
+		t.Errorf("error = %v, want mention of user and zone", err)
+	}
+}
+
+// ─── loadAccessPolicy ────────────────────────────────────────────────────────
+
+func TestLoadAccessPolicy_Valid(t *testing.T) {
+	path := writePolicyFile(t, `{
+		"default_role": "viewer",
+		"grants": [{"groups": ["web"], "role": "editor", "zones": ["Example.com"], "methods": ["PATCH"]}]
+	}`)
+
+	policy, err := loadAccessPolicy(path)
+	if err != nil {
+		t.Fatalf("loadAccessPolicy returned error: %v", err)
+	}
+	if policy.Grants[0].Zones[0] != "example.com." {
+		t.Errorf("zone = %q, want canonical %q", policy.Grants[0].Zones[0], "example.com.")
+	}
+}
+
+func TestLoadAccessPolicy_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown role":   `{"grants": [{"users": ["a"], "role": "owner"}]}`,
+		"unknown field":  `{"grants": [{"users": ["a"], "role": "viewer", "zone": "x"}]}`,
+		"no subjects":    `{"grants": [{"role": "viewer"}]}`,
+		"bad method":     `{"grants": [{"users": ["a"], "role": "editor", "methods": ["TRACE"]}]}`,
+		"bad default":    `{"default_role": "root"}`,
+		"malformed json": `{"grants": [`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadAccessPolicy(writePolicyFile(t, content)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// ─── handlePDNSProxy с политикой доступа ─────────────────────────────────────
+
+func TestPDNSProxy_PolicyDenied_Returns403WithoutUpstreamCall(t *testing.T) {
+	called := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	proxy := &pdnsProxy{client: newProxyClient(), policy: &accessPolicy{Grants: []accessGrant{
+		{Groups: []string{"noc"}, Role: roleViewer},
+	}}}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.com.", strings.NewReader(`{"rrsets":[]}`))
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "nick", Groups: []string{"noc"}}))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body["detail"] == "" {
+		t.Error("detail field missing in error response")
+	}
+	if called {
+		t.Error("upstream must not be contacted for denied requests")
+	}
+}
+
+func TestPDNSProxy_PolicyAllowed_Forwards(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	proxy := &pdnsProxy{client: newProxyClient(), policy: &accessPolicy{Grants: []accessGrant{
+		{Groups: []string{"web"}, Role: roleEditor, Zones: []string{"example.com."}},
+	}}}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.com.", strings.NewReader(`{"rrsets":[]}`))
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "wanda", Groups: []string{"web"}}))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestPDNSProxy_ZoneScopedGrant_CannotSearchAllZones(t *testing.T) {
+	called := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		writeJSON(w, http.StatusOK, []any{})
+	}))
+	defer backend.Close()
+	t.Setenv("PDNS_API_URL", backend.URL)
+
+	proxy := &pdnsProxy{client: newProxyClient(), policy: &accessPolicy{Grants: []accessGrant{
+		{Groups: []string{"web"}, Role: roleAdmin, Zones: []string{"example.com."}},
+	}}}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/search-data?q=*", nil)
+	req = req.WithContext(withIdentity(req.Context(), identity{User: "wanda", Groups: []string{"web"}}))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if called {
+		t.Error("search across all zones must not reach PowerDNS for a zone-scoped grant")
+	}
+}
+
+func TestPDNSProxy_PathTraversal_Returns400(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones/%2e%2e/config", nil)
+	w := httptest.NewRecorder()
+	proxyHandler()(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func writePolicyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write policy file: %v", err)
+	}
+	return path
+}
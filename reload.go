@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configReloader re-reads .env and the config file on SIGHUP, or when their
+// modification time changes, and swaps the PowerDNS backends. Other settings
+// are only reported because they are wired up once at startup.
+type configReloader struct {
+	dotEnvPath string
+	configFile string
+	// baseEnv holds the variables of the real process environment, which
+	// always win over .env and the config file and are never reloaded.
+	baseEnv  map[string]bool
+	backends *backendSet
+	// policy is the access policy as last read. It is compared on reload to
+	// report changes, which need a restart.
+	policy *accessPolicy
+
+	mu sync.Mutex
+}
+
+// backendEnvKeys are applied by swapping backends and need no restart.
+var backendEnvKeys = []string{"PDNS_API_URL", "PDNS_API_KEY", "PDNS_API_KEY_FILE", "PDNS_SERVER_ID", "PDNS_BACKENDS_FILE"}
+
+func environKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+	return keys
+}
+
+func (r *configReloader) run(watchInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if watchInterval > 0 {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	modTimes := r.modTimes()
+	for {
+		select {
+		case <-hup:
+			log.Printf("received SIGHUP, reloading configuration")
+		case <-tick:
+			current := r.modTimes()
+			if maps.Equal(current, modTimes) {
+				continue
+			}
+			log.Printf("configuration files changed, reloading")
+		}
+
+		if err := r.reload(); err != nil {
+			log.Printf("configuration reload failed, keeping previous backends: %v", err)
+		}
+		modTimes = r.modTimes()
+	}
+}
+
+// modTimes covers .env, the config file and the files they name, including
+// the api_key_file of every backend.
+func (r *configReloader) modTimes() map[string]time.Time {
+	paths := []string{r.dotEnvPath, r.configFile, getEnv("PDNS_BACKENDS_FILE", ""), getEnv("PDNS_API_KEY_FILE", ""), getEnv("AUTH_POLICY_FILE", "")}
+	for _, backend := range r.backends.get() {
+		paths = append(paths, backend.KeyFile)
+	}
+
+	times := make(map[string]time.Time)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// reload refreshes the variables that came from .env or the config file and
+// installs the new backends. Requests already in flight keep the backend they
+// resolved before the swap.
+func (r *configReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var fileCfg *fileConfig
+	if r.configFile != "" {
+		var err error
+		if fileCfg, err = loadConfigFile(r.configFile); err != nil {
+			return err
+		}
+	}
+
+	// The backends are read from the environment, so the new variables are
+	// applied first and rolled back unless the backends load as well.
+	before := r.managedEnv()
+	backends, err := r.applyEnv(fileCfg)
+	if err != nil {
+		r.setManagedEnv(before)
+		return err
+	}
+	policy, err := loadPolicyConfig(fileCfg)
+	if err != nil {
+		r.setManagedEnv(before)
+		return err
+	}
+	after := r.managedEnv()
+	previous := r.backends.swap(backends)
+
+	changes := diffBackends(previous, backends)
+	for _, key := range diffEnvKeys(before, after) {
+		if !slices.Contains(backendEnvKeys, key) {
+			changes = append(changes, key+" changed, restart required to apply")
+		}
+	}
+	if !reflect.DeepEqual(policy, r.policy) {
+		changes = append(changes, "access policy changed, restart required to apply")
+		r.policy = policy
+	}
+
+	if len(changes) == 0 {
+		log.Printf("configuration reloaded, nothing changed")
+		return nil
+	}
+	for _, change := range changes {
+		log.Printf("configuration reloaded: %s", change)
+	}
+	return nil
+}
+
+// applyEnv replaces the managed variables with those of .env and the config
+// file and loads the backends they describe.
+func (r *configReloader) applyEnv(fileCfg *fileConfig) ([]pdnsConfig, error) {
+	r.setManagedEnv(nil)
+	loadDotEnv(r.dotEnvPath)
+	if fileCfg != nil {
+		if err := fileCfg.applyEnv(); err != nil {
+			return nil, err
+		}
+	}
+	return loadBackendConfig(fileCfg)
+}
+
+// setManagedEnv unsets the variables set from .env or the config file and
+// sets env instead.
+func (r *configReloader) setManagedEnv(env map[string]string) {
+	for key := range r.managedEnv() {
+		os.Unsetenv(key)
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+	}
+}
+
+// managedEnv returns the variables set from .env or the config file.
+func (r *configReloader) managedEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !r.baseEnv[key] {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+func diffEnvKeys(before, after map[string]string) []string {
+	var keys []string
+	for key, value := range after {
+		if old, ok := before[key]; !ok || old != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// diffBackends describes added, removed and modified backends without
+// revealing API keys.
+func diffBackends(previous, current []pdnsConfig) []string {
+	var changes []string
+	for _, old := range previous {
+		i := slices.IndexFunc(current, func(b pdnsConfig) bool { return b.Name == old.Name })
+		if i < 0 {
+			changes = append(changes, fmt.Sprintf("backend %q removed", old.Name))
+			continue
+		}
+		updated := current[i]
+		if old.URL != updated.URL {
+			changes = append(changes, fmt.Sprintf("backend %q url %s -> %s", old.Name, old.URL, updated.URL))
+		}
+		if old.ServerID != updated.ServerID {
+			changes = append(changes, fmt.Sprintf("backend %q server_id %s -> %s", old.Name, old.ServerID, updated.ServerID))
+		}
+		if old.ReadOnly != updated.ReadOnly {
+			changes = append(changes, fmt.Sprintf("backend %q read_only %t -> %t", old.Name, old.ReadOnly, updated.ReadOnly))
+		}
+		if old.Key != updated.Key {
+			changes = append(changes, fmt.Sprintf("backend %q api_key changed", old.Name))
+		}
+	}
+	for _, backend := range current {
+		if !slices.ContainsFunc(previous, func(b pdnsConfig) bool { return b.Name == backend.Name }) {
+			changes = append(changes, fmt.Sprintf("backend %q added (%s)", backend.Name, backend.URL))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ─── configReloader.reload ───────────────────────────────────────────────────
+
+func TestConfigReloader_RotatesAPIKeyFromDotEnv(t *testing.T) {
+	unsetEnv(t, "PDNS_API_URL", "PDNS_API_KEY", "PDNS_SERVER_ID", "PDNS_BACKENDS_FILE")
+	dotEnv := filepath.Join(t.TempDir(), ".env")
+	writeFile(t, dotEnv, "PDNS_API_URL=http://pdns:8081\nPDNS_API_KEY=old-key\n")
+
+	reloader := &configReloader{dotEnvPath: dotEnv, baseEnv: environKeys()}
+	loadDotEnv(dotEnv)
+	backends, err := loadBackendConfig(nil)
+	if err != nil {
+		t.Fatalf("loadBackendConfig: %v", err)
+	}
+	reloader.backends = newBackendSet(backends)
+	inFlight := reloader.backends.get()[0]
+
+	writeFile(t, dotEnv, "PDNS_API_URL=http://pdns:8081\nPDNS_API_KEY=new-key\n")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if got := reloader.backends.get()[0].Key; got != "new-key" {
+		t.Errorf("Key = %q after reload, want %q", got, "new-key")
+	}
+	if inFlight.Key != "old-key" {
+		t.Errorf("backend resolved before the reload changed to %q", inFlight.Key)
+	}
+}
+
+func TestConfigReloader_RereadsAPIKeyFile(t *testing.T) {
+	unsetEnv(t, "PDNS_API_URL", "PDNS_API_KEY", "PDNS_SERVER_ID", "PDNS_BACKENDS_FILE")
+	keyFile := filepath.Join(t.TempDir(), "api_key")
+	writeFile(t, keyFile, "old-key\n")
+	t.Setenv("PDNS_API_KEY_FILE", keyFile)
+
+	reloader := &configReloader{baseEnv: environKeys(), backends: newBackendSet([]pdnsConfig{getPDNSConfig()})}
+	writeFile(t, keyFile, "new-key\n")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if got := reloader.backends.get()[0].Key; got != "new-key" {
+		t.Errorf("Key = %q after reload, want %q", got, "new-key")
+	}
+}
+
+func TestConfigReloader_WatchesBackendKeyFiles(t *testing.T) {
+	unsetEnv(t, "PDNS_API_URL", "PDNS_API_KEY", "PDNS_API_KEY_FILE", "PDNS_SERVER_ID", "AUTH_POLICY_FILE")
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "eu.key")
+	writeFile(t, keyFile, "old-key\n")
+	backendsFile := filepath.Join(dir, "backends.json")
+	writeFile(t, backendsFile, `{"backends": [{"name": "eu", "url": "http://eu:8081", "api_key_file": "`+keyFile+`"}]}`)
+	t.Setenv("PDNS_BACKENDS_FILE", backendsFile)
+
+	backends, err := loadBackendConfig(nil)
+	if err != nil {
+		t.Fatalf("loadBackendConfig: %v", err)
+	}
+	reloader := &configReloader{baseEnv: environKeys(), backends: newBackendSet(backends)}
+	before := reloader.modTimes()
+
+	writeFile(t, keyFile, "new-key\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if maps.Equal(reloader.modTimes(), before) {
+		t.Fatal("rewriting a backend api_key_file does not change the watched modification times")
+	}
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := reloader.backends.get()[0].Key; got != "new-key" {
+		t.Errorf("Key = %q after reload, want %q", got, "new-key")
+	}
+}
+
+func TestConfigReloader_InvalidConfigKeepsBackends(t *testing.T) {
+	unsetEnv(t, "PDNS_API_URL", "PDNS_API_KEY", "PDNS_SERVER_ID", "PDNS_BACKENDS_FILE")
+	path := writeConfigFile(t, "backends:\n  - {name: eu, url: http://eu:8081, api_key: k1}\n")
+
+	fileCfg, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	reloader := &configReloader{configFile: path, baseEnv: environKeys(), backends: newBackendSet(fileCfg.Backends)}
+
+	writeFile(t, path, "backends:\n  - {name: eu, url: http://eu:8081, apikey: k2}\n")
+	if err := reloader.reload(); err == nil || !strings.Contains(err.Error(), "backends[0].apikey") {
+		t.Errorf("reload error = %v, want unknown key backends[0].apikey", err)
+	}
+	if got := reloader.backends.get()[0].Key; got != "k1" {
+		t.Errorf("Key = %q, previous backends must be kept", got)
+	}
+
+	writeFile(t, path, "backends:\n  - {name: eu, url: http://eu:8081, api_key: k2}\n  - {name: us, url: http://us:8081, api_key: k3}\n")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := reloader.backends.get(); len(got) != 2 || got[0].Key != "k2" {
+		t.Errorf("backends after reload = %+v", got)
+	}
+}
+
+func TestConfigReloader_FailedReloadKeepsEnvironment(t *testing.T) {
+	unsetEnv(t, "PDNS_API_URL", "PDNS_API_KEY", "PDNS_API_KEY_FILE", "PDNS_SERVER_ID", "PDNS_BACKENDS_FILE")
+	dir := t.TempDir()
+	dotEnv := filepath.Join(dir, ".env")
+	writeFile(t, dotEnv, "PDNS_API_URL=http://old:8081\nPDNS_API_KEY=k1\n")
+
+	reloader := &configReloader{dotEnvPath: dotEnv, baseEnv: environKeys()}
+	loadDotEnv(dotEnv)
+	reloader.backends = newBackendSet([]pdnsConfig{getPDNSConfig()})
+
+	writeFile(t, dotEnv, "PDNS_API_URL=http://new:8081\nPDNS_API_KEY_FILE="+filepath.Join(dir, "missing")+"\n")
+	if err := reloader.reload(); err == nil {
+		t.Fatal("reload succeeded with an unreadable PDNS_API_KEY_FILE")
+	}
+	if got := os.Getenv("PDNS_API_URL"); got != "http://old:8081" {
+		t.Errorf("PDNS_API_URL = %q after a failed reload, want the previous value", got)
+	}
+	if _, ok := os.LookupEnv("PDNS_API_KEY_FILE"); ok {
+		t.Error("PDNS_API_KEY_FILE is set after a failed reload")
+	}
+	if got := reloader.backends.get()[0]; got.URL != "http://old:8081" || got.Key != "k1" {
+		t.Errorf("backend = %+v, previous backends must be kept", got)
+	}
+}
+
+func TestConfigReloader_ReportsPolicyChanges(t *testing.T) {
+	unsetEnv(t, "PDNS_API_URL", "PDNS_API_KEY", "PDNS_SERVER_ID", "PDNS_BACKENDS_FILE", "AUTH_POLICY_FILE")
+	backends := "backends:\n  - {name: eu, url: http://eu:8081, api_key: k1}\n"
+	path := writeConfigFile(t, backends+"policy:\n  default_role: viewer\n")
+
+	fileCfg, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	reloader := &configReloader{configFile: path, baseEnv: environKeys(), backends: newBackendSet(fileCfg.Backends), policy: fileCfg.Policy}
+
+	logs := captureLogs(t)
+	writeFile(t, path, backends+"policy:\n  default_role: admin\n")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !strings.Contains(logs.String(), "access policy changed, restart required") {
+		t.Errorf("logs = %s, want the inline policy change reported", logs.String())
+	}
+
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	writeFile(t, policyFile, `{"default_role": "admin"}`)
+	writeFile(t, path, backends+"auth:\n  policy_file: "+policyFile+"\n")
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	logs.Reset()
+	writeFile(t, policyFile, `{"default_role": "editor"}`)
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !strings.Contains(logs.String(), "access policy changed, restart required") {
+		t.Errorf("logs = %s, want the policy file change reported", logs.String())
+	}
+}
+
+// ─── diffBackends ────────────────────────────────────────────────────────────
+
+func TestDiffBackends_DescribesChangesWithoutKeys(t *testing.T) {
+	previous := []pdnsConfig{
+		{Name: "eu", URL: "http://eu", Key: "secret-old", ServerID: "localhost"},
+		{Name: "us", URL: "http://us", Key: "k", ServerID: "localhost"},
+	}
+	current := []pdnsConfig{
+		{Name: "eu", URL: "http://eu2", Key: "secret-new", ServerID: "localhost"},
+		{Name: "ap", URL: "http://ap", Key: "k", ServerID: "localhost"},
+	}
+
+	changes := diffBackends(previous, current)
+	want := []string{
+		`backend "eu" url http://eu -> http://eu2`,
+		`backend "eu" api_key changed`,
+		`backend "us" removed`,
+		`backend "ap" added (http://ap)`,
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+	for _, change := range changes {
+		if strings.Contains(change, "secret") {
+			t.Errorf("change %q reveals an API key", change)
+		}
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
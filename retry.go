@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxRetryBackoff caps the delay between two attempts of one request.
+const maxRetryBackoff = 2 * time.Second
+
+// retryConfig controls how GET requests to PowerDNS are retried after a
+// transient failure: a timeout or a refused connection.
+type retryConfig struct {
+	// Retries is the number of attempts after the first; zero disables them.
+	Retries int
+	// Backoff is the base delay, doubled for every further attempt and
+	// jittered so clients do not retry in lockstep.
+	Backoff time.Duration
+}
+
+// breakerConfig controls the per-backend circuit breakers.
+type breakerConfig struct {
+	// Threshold is the number of consecutive transient failures that open the
+	// circuit; zero disables the breaker.
+	Threshold int
+	// Cooldown is how long an open circuit fails fast before a single
+	// half-open probe is let through.
+	Cooldown time.Duration
+}
+
+func getRetryConfig() retryConfig {
+	return retryConfig{
+		Retries: getEnvInt("PROXY_RETRIES", 2),
+		Backoff: getEnvDuration("PROXY_RETRY_BACKOFF", 100*time.Millisecond),
+	}
+}
+
+func getBreakerConfig() breakerConfig {
+	return breakerConfig{
+		Threshold: getEnvInt("PROXY_BREAKER_THRESHOLD", 5),
+		Cooldown:  getEnvDuration("PROXY_BREAKER_COOLDOWN", 30*time.Second),
+	}
+}
+
+// delay returns the jittered backoff before the given retry (starting at 1):
+// a random duration between half and all of Backoff·2^(retry-1).
+func (c retryConfig) delay(retry int) time.Duration {
+	d := c.Backoff << (retry - 1)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// isTransient reports whether a failed upstream request is worth retrying and
+// counts against the circuit breaker.
+func isTransient(err error) bool {
+	reason := proxyErrorReason(err)
+	return reason == "timeout" || reason == "connect_refused"
+}
+
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half-open"
+)
+
+// circuitBreaker stops sending requests to a backend that keeps failing.
+// After Threshold consecutive transient failures it opens and requests fail
+// fast; once Cooldown has passed one request is let through as a probe, and
+// its outcome closes the circuit again or restarts the cooldown.
+type circuitBreaker struct {
+	name string
+	cfg  breakerConfig
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// circuitOpenError is returned instead of contacting a backend whose circuit
+// is open.
+type circuitOpenError struct {
+	backend  string
+	failures int
+	retryIn  time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	if e.retryIn <= 0 {
+		return fmt.Sprintf("PowerDNS backend %q is unavailable after %d consecutive failures; checking whether it recovered",
+			e.backend, e.failures)
+	}
+	return fmt.Sprintf("PowerDNS backend %q is unavailable after %d consecutive failures; retrying in %s",
+		e.backend, e.failures, e.retryIn.Round(time.Second))
+}
+
+// allow reports whether a request may be sent. In the half-open state only
+// one probe is in flight at a time.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if wait := b.cfg.Cooldown - time.Since(b.openedAt); wait > 0 {
+			return &circuitOpenError{backend: b.name, failures: b.failures, retryIn: wait}
+		}
+		b.state, b.probing = circuitHalfOpen, true
+		slog.Info("circuit breaker half-open, probing backend", "backend", b.name)
+	case circuitHalfOpen:
+		if b.probing {
+			return &circuitOpenError{backend: b.name, failures: b.failures, retryIn: 0}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a request it allowed. Any
+// response from PowerDNS, even an error status, shows the backend is
+// reachable; only transient errors count as failures, and other errors such
+// as a cancelled request say nothing about the backend.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err != nil && !isTransient(err) {
+		return
+	}
+	if err == nil {
+		if b.state != circuitClosed {
+			slog.Info("circuit breaker closed, backend recovered", "backend", b.name)
+		}
+		b.state, b.failures = circuitClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.cfg.Threshold {
+		if b.state != circuitOpen {
+			slog.Warn("circuit breaker opened", "backend", b.name, "failures", b.failures, "cooldown", b.cfg.Cooldown.String(), "error", err)
+		}
+		b.state, b.openedAt = circuitOpen, time.Now()
+	}
+}
+
+func (b *circuitBreaker) currentState() circuitState {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// circuitBreakers holds one breaker per backend name. Breakers survive
+// reloads, so a backend that is still down stays open.
+type circuitBreakers struct {
+	cfg breakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// newCircuitBreakers returns nil when the breaker is disabled; a nil set hands
+// out nil breakers, which allow every request.
+func newCircuitBreakers(cfg breakerConfig) *circuitBreakers {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	return &circuitBreakers{cfg: cfg, breakers: make(map[string]*circuitBreaker)}
+}
+
+func (s *circuitBreakers) get(name string) *circuitBreaker {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.breakers[name]
+	if b == nil {
+		b = &circuitBreaker{name: name, cfg: s.cfg, state: circuitClosed}
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// do sends an upstream request through the backend's circuit breaker. GET
+// requests are retried after transient failures; the body of other methods
+// may already have been applied, so they are sent once.
+func (p *pdnsProxy) do(req *http.Request, cfg pdnsConfig, class string) (*http.Response, error) {
+	breaker := p.breakers.get(cfg.Name)
+	retries := 0
+	if req.Method == http.MethodGet {
+		retries = max(p.retry.Retries, 0)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := breaker.allow(); err != nil {
+			return nil, err
+		}
+		resp, err := p.timeouts.sendWithHeaderTimeout(p.client, req, class)
+		breaker.record(err)
+		if err == nil || attempt >= retries || !isTransient(err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		delay := p.retry.delay(attempt + 1)
+		requestLogger(req).Info("retrying proxy request", "backend", cfg.Name, "attempt", attempt+1, "delay_ms", delay.Milliseconds(), "error", err)
+		select {
+		case <-req.Context().Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// ─── retryConfig ─────────────────────────────────────────────────────────────
+
+func TestRetryConfig_DelayIsJitteredAndCapped(t *testing.T) {
+	cfg := retryConfig{Backoff: 100 * time.Millisecond}
+	for i := 0; i < 50; i++ {
+		if d := cfg.delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("delay(1) = %s, want 50ms–100ms", d)
+		}
+		if d := cfg.delay(3); d < 200*time.Millisecond || d > 400*time.Millisecond {
+			t.Fatalf("delay(3) = %s, want 200ms–400ms", d)
+		}
+		if d := cfg.delay(20); d > maxRetryBackoff {
+			t.Fatalf("delay(20) = %s, want at most %s", d, maxRetryBackoff)
+		}
+	}
+}
+
+// ─── circuitBreaker ──────────────────────────────────────────────────────────
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	breaker := newCircuitBreakers(breakerConfig{Threshold: 2, Cooldown: 20 * time.Millisecond}).get("main")
+
+	for range 2 {
+		if err := breaker.allow(); err != nil {
+			t.Fatalf("closed circuit rejected a request: %v", err)
+		}
+		breaker.record(connectRefusedError())
+	}
+	var openErr *circuitOpenError
+	if err := breaker.allow(); !errors.As(err, &openErr) || openErr.failures != 2 {
+		t.Fatalf("allow() = %v, want circuitOpenError after 2 failures", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("half-open circuit rejected the probe: %v", err)
+	}
+	if breaker.currentState() != circuitHalfOpen {
+		t.Errorf("state = %q, want half-open", breaker.currentState())
+	}
+	if err := breaker.allow(); err == nil {
+		t.Error("half-open circuit let a second request through while probing")
+	}
+
+	breaker.record(nil)
+	if breaker.currentState() != circuitClosed {
+		t.Errorf("state = %q after a successful probe, want closed", breaker.currentState())
+	}
+	if err := breaker.allow(); err != nil {
+		t.Errorf("closed circuit rejected a request: %v", err)
+	}
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	breaker := newCircuitBreakers(breakerConfig{Threshold: 1, Cooldown: 20 * time.Millisecond}).get("main")
+	breaker.allow()
+	breaker.record(connectRefusedError())
+
+	time.Sleep(30 * time.Millisecond)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("half-open circuit rejected the probe: %v", err)
+	}
+	breaker.record(connectRefusedError())
+	if breaker.currentState() != circuitOpen {
+		t.Errorf("state = %q after a failed probe, want open", breaker.currentState())
+	}
+	if err := breaker.allow(); err == nil {
+		t.Error("reopened circuit let a request through before the cooldown")
+	}
+}
+
+func TestCircuitBreaker_IgnoresNonTransientErrors(t *testing.T) {
+	breaker := newCircuitBreakers(breakerConfig{Threshold: 1, Cooldown: time.Minute}).get("main")
+	breaker.allow()
+	breaker.record(errors.New("context canceled"))
+	if breaker.currentState() != circuitClosed {
+		t.Errorf("state = %q, want a cancelled request not to count", breaker.currentState())
+	}
+}
+
+func TestCircuitBreakers_DisabledAllowsEverything(t *testing.T) {
+	breakers := newCircuitBreakers(breakerConfig{Threshold: 0})
+	breaker := breakers.get("main")
+	for range 10 {
+		breaker.record(connectRefusedError())
+	}
+	if err := breaker.allow(); err != nil {
+		t.Errorf("disabled breaker rejected a request: %v", err)
+	}
+}
+
+// ─── pdnsProxy retries ───────────────────────────────────────────────────────
+
+func TestPDNSProxy_RetriesTransientGET(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []any{})
+	}))
+	defer backend.Close()
+
+	transport := &flakyTransport{failures: 2}
+	proxy := newTestProxy(backend.URL)
+	proxy.client = &http.Client{Transport: transport}
+	proxy.retry = retryConfig{Retries: 2, Backoff: time.Millisecond}
+	proxy.breakers = newCircuitBreakers(breakerConfig{})
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 after retries: %s", w.Code, w.Body.String())
+	}
+	if got := transport.calls.Load(); got != 3 {
+		t.Errorf("upstream attempts = %d, want 3", got)
+	}
+}
+
+func TestPDNSProxy_GivesUpAfterRetries(t *testing.T) {
+	transport := &flakyTransport{failures: 100}
+	proxy := newTestProxy("http://pdns.invalid")
+	proxy.client = &http.Client{Transport: transport}
+	proxy.retry = retryConfig{Retries: 2, Backoff: time.Millisecond}
+	proxy.breakers = newCircuitBreakers(breakerConfig{})
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := transport.calls.Load(); got != 3 {
+		t.Errorf("upstream attempts = %d, want 1 + 2 retries", got)
+	}
+}
+
+func TestPDNSProxy_DoesNotRetryChanges(t *testing.T) {
+	transport := &flakyTransport{failures: 1}
+	proxy := newTestProxy("http://pdns.invalid")
+	proxy.client = &http.Client{Transport: transport}
+	proxy.retry = retryConfig{Retries: 2, Backoff: time.Millisecond}
+	proxy.breakers = newCircuitBreakers(breakerConfig{})
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/api/pdns/servers/localhost/zones/example.org.", strings.NewReader(`{"rrsets":[]}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := transport.calls.Load(); got != 1 {
+		t.Errorf("upstream attempts = %d, want PATCH sent once", got)
+	}
+}
+
+func TestPDNSProxy_OpenCircuitFailsFast(t *testing.T) {
+	transport := &flakyTransport{failures: 100}
+	proxy := newTestProxy("http://pdns.invalid")
+	proxy.client = &http.Client{Transport: transport}
+	proxy.retry = retryConfig{Retries: 2, Backoff: time.Millisecond}
+	proxy.breakers = newCircuitBreakers(breakerConfig{Threshold: 3, Cooldown: time.Minute})
+
+	proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil))
+	if got := transport.calls.Load(); got != 3 {
+		t.Fatalf("upstream attempts = %d, want 3 before the circuit opens", got)
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/pdns/servers/localhost/zones/example.org./notify", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	var body map[string]string
+	json.NewDecoder(w.Body).Decode(&body)
+	if !strings.Contains(body["detail"], `backend "main" is unavailable after 3 consecutive failures`) {
+		t.Errorf("detail = %q", body["detail"])
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header missing")
+	}
+	if got := transport.calls.Load(); got != 3 {
+		t.Errorf("upstream attempts = %d, want the open circuit to skip PowerDNS", got)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+// flakyTransport refuses the first failures connections and then passes
+// requests to the default transport.
+type flakyTransport struct {
+	failures int32
+	calls    atomic.Int32
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.calls.Add(1) <= f.failures {
+		return nil, connectRefusedError()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func connectRefusedError() error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+}
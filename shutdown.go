@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+type shutdownConfig struct {
+	// DrainDelay is how long /readyz fails before the listener closes, so
+	// load balancers stop sending new traffic first.
+	DrainDelay time.Duration
+	// Timeout bounds how long in-flight requests may take to finish.
+	Timeout time.Duration
+}
+
+func getShutdownConfig() shutdownConfig {
+	return shutdownConfig{
+		DrainDelay: getEnvDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		Timeout:    getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+}
+
+// gracefulShutdown flips readiness to failing, waits DrainDelay, then stops
+// accepting connections and lets in-flight requests finish within Timeout.
+// Connections still open after the deadline are closed.
+func gracefulShutdown(health *healthState, cfg shutdownConfig, servers ...*http.Server) error {
+	health.draining.Store(true)
+	if cfg.DrainDelay > 0 {
+		log.Printf("draining: readiness is failing, closing listeners in %s", cfg.DrainDelay)
+		time.Sleep(cfg.DrainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			err := server.Shutdown(ctx)
+			if errors.Is(err, context.DeadlineExceeded) {
+				server.Close()
+			}
+			errs <- err
+		}()
+	}
+
+	var shutdownErr error
+	for range servers {
+		if err := <-errs; err != nil {
+			shutdownErr = err
+		}
+	}
+	if errors.Is(shutdownErr, context.DeadlineExceeded) {
+		log.Printf("shutdown timeout of %s exceeded, closed remaining connections", cfg.Timeout)
+	}
+	return shutdownErr
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// ─── gracefulShutdown ────────────────────────────────────────────────────────
+
+func TestGracefulShutdown_DrainsInFlightRequests(t *testing.T) {
+	health := &healthState{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", health.handleReady)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	server, url := startTestServer(t, mux)
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		done <- gracefulShutdown(health, shutdownConfig{DrainDelay: 200 * time.Millisecond, Timeout: 5 * time.Second}, server)
+	}()
+
+	// Readiness fails during the drain delay while the listener still accepts.
+	waitFor(t, health.draining.Load)
+	resp, err := http.Get(url + "/readyz")
+	if err != nil {
+		t.Fatalf("readyz during drain: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("readyz during drain = %d, want 503", resp.StatusCode)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("gracefulShutdown: %v", err)
+	}
+	if res := <-slow; res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request = %q, %v; want it to complete", res.body, res.err)
+	}
+	if _, err := http.Get(url + "/readyz"); err == nil {
+		t.Error("listener still accepts connections after shutdown")
+	}
+}
+
+func TestGracefulShutdown_ClosesAfterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+
+	server, url := startTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go http.Get(url)
+	<-started
+
+	err := gracefulShutdown(&healthState{}, shutdownConfig{Timeout: 50 * time.Millisecond}, server)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+func startTestServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	return server, "http://" + ln.Addr().String()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -7,7 +7,11 @@
 // ---- State -------------------------------------------------------
 const state = {
   serverId: 'localhost',
+  backend: null,       // selected backend name, null for the default
+  backends: [],
   uiVersion: 'n/a',
+  user: null,
+  readOnly: false,     // global read-only mode from /api/config
   pdnsVersion: 'n/a',
   currentView: null,
   currentZone: null,   // full zone object when in records view
@@ -16,11 +20,17 @@ const state = {
   selectedZones: new Set(),
   selectedRecords: new Set(),
   autoprimaries: [],
+  historyEntries: [],  // change history of the current zone
 };
 
 // ---- HTTP helpers ------------------------------------------------
 const http = {
   async request(method, path, data) {
+    const prefix = state.backend ? `${encodeURIComponent(state.backend)}/` : '';
+    return http.fetchJSON(method, `/api/pdns/${prefix}${path}`, data);
+  },
+
+  async fetchJSON(method, url, data) {
     const opts = {
       method,
       headers: { 'Content-Type': 'application/json' },
@@ -29,16 +39,20 @@ const http = {
       opts.body = JSON.stringify(data);
     }
 
-    const resp = await fetch(`/api/pdns/${path}`, opts);
+    const resp = await fetch(url, opts);
 
     if (resp.status === 204) return null;
+    if (resp.status === 401) {
+      window.location.href = `/login?next=${encodeURIComponent(window.location.pathname)}`;
+      throw new Error('Session expired, please sign in again');
+    }
 
     const text = await resp.text();
     let json;
     try { json = JSON.parse(text); } catch { json = { message: text }; }
 
     if (!resp.ok) {
-      const msg = json?.error || json?.message || json?.result || `HTTP ${resp.status}`;
+      const msg = json?.error || json?.message || json?.detail || json?.result || `HTTP ${resp.status}`;
       throw new Error(typeof msg === 'string' ? msg : JSON.stringify(msg));
     }
     return json;
@@ -73,6 +87,14 @@ const pdns = {
   deleteAutoprimary:  (ip, ns)   => http.del(`servers/${state.serverId}/autoprimaries/${encodeURIComponent(ip)}/${encodeURIComponent(ns)}`),
 };
 
+// ---- Change history (HISTORY_FILE) -------------------------------
+const changeHistory = {
+  list: (zone) => http.fetchJSON('GET',
+    `/api/history/${encodeURIComponent(zone)}?limit=50${state.backend ? `&backend=${encodeURIComponent(state.backend)}` : ''}`),
+  revert: (zone, id) => http.fetchJSON('POST',
+    `/api/history/${encodeURIComponent(zone)}/${encodeURIComponent(id)}/revert`),
+};
+
 // Encode zone IDs for use in URL paths
 function enc(id) {
   // Zone IDs are FQDNs like "example.com." – dots are safe but we still
@@ -123,6 +145,60 @@ function setFooterVersion(id, prefix, version) {
   el.textContent = `${prefix} ${raw || 'n/a'}`;
 }
 
+function setCurrentUser(user) {
+  const el = document.getElementById('topbar-user');
+  if (!el) return;
+
+  el.style.display = user ? '' : 'none';
+  document.getElementById('topbar-user-name').textContent = user || '';
+}
+
+const backendStorageKey = 'pdns-ui-backend';
+
+function setBackends(backends) {
+  state.backends = Array.isArray(backends) ? backends : [];
+
+  let stored = null;
+  try { stored = localStorage.getItem(backendStorageKey); } catch { /* storage blocked */ }
+  const selected = state.backends.find(b => b.name === stored) || state.backends[0];
+  if (selected) {
+    state.backend = state.backends.length > 1 ? selected.name : null;
+    state.serverId = selected.server_id || state.serverId;
+  }
+  setReadOnly(state.readOnly || Boolean(selected?.read_only));
+
+  const select = document.getElementById('backend-select');
+  if (!select) return;
+  select.style.display = state.backends.length > 1 ? '' : 'none';
+  select.innerHTML = state.backends
+    .map(b => `<option value="${esc(b.name)}"${selected && b.name === selected.name ? ' selected' : ''}>${esc(b.name)}</option>`)
+    .join('');
+}
+
+function switchBackend(name) {
+  const backend = state.backends.find(b => b.name === name);
+  if (!backend) return;
+
+  try { localStorage.setItem(backendStorageKey, name); } catch { /* storage blocked */ }
+  state.backend = name;
+  state.serverId = backend.server_id || 'localhost';
+  setReadOnly(state.readOnly || Boolean(backend.read_only));
+  state.zones = [];
+  state.currentZone = null;
+
+  setFooterVersion('pdns-version', 'pdns', 'loading...');
+  void refreshPDNSVersion();
+  navigate('zones');
+}
+
+// setReadOnly hides the controls that change PowerDNS data; the proxy
+// rejects those requests anyway.
+function setReadOnly(readOnly) {
+  document.body.classList.toggle('read-only', readOnly);
+  const badge = document.getElementById('read-only-badge');
+  if (badge) badge.style.display = readOnly ? '' : 'none';
+}
+
 async function refreshPDNSVersion() {
   try {
     const info = await pdns.getServerInfo();
@@ -364,7 +440,7 @@ const views = {
             .sort((a, b) => a.name.localeCompare(b.name))
             .map((z, i) => `
           <tr>
-            <td style="width:1%">
+            <td class="edit-control" style="width:1%">
               <input type="checkbox" class="form-check-input zone-select" value="${esc(z.id)}"
                 onchange="onZoneCheckboxChange()">
             </td>
@@ -384,12 +460,12 @@ const views = {
                   <i class="bi bi-list-ul"></i>
                 </button>
                 ${z.kind === 'Master' || z.kind === 'Native' ? `
-                <button class="btn btn-outline-warning" title="Notify slaves"
+                <button class="btn btn-outline-warning edit-control" title="Notify slaves"
                   onclick="handlers.notifyZone(${i})">
                   <i class="bi bi-broadcast"></i>
                 </button>` : ''}
                 ${z.kind === 'Slave' ? `
-                <button class="btn btn-outline-secondary" title="Retrieve from master (AXFR)"
+                <button class="btn btn-outline-secondary edit-control" title="Retrieve from master (AXFR)"
                   onclick="handlers.axfrRetrieve(${i})">
                   <i class="bi bi-cloud-download"></i>
                 </button>` : ''}
@@ -397,11 +473,11 @@ const views = {
                   onclick="handlers.exportZone(${i})">
                   <i class="bi bi-download"></i>
                 </button>
-                <button class="btn btn-outline-secondary" title="Edit"
+                <button class="btn btn-outline-secondary edit-control" title="Edit"
                   onclick="handlers.showZoneEdit(${i})">
                   <i class="bi bi-pencil"></i>
                 </button>
-                <button class="btn btn-outline-danger" title="Delete"
+                <button class="btn btn-outline-danger edit-control" title="Delete"
                   onclick="handlers.deleteZone(${i})">
                   <i class="bi bi-trash"></i>
                 </button>
@@ -420,11 +496,11 @@ const views = {
           <h2><i class="bi bi-globe2 me-2 text-primary"></i>Zones</h2>
           <span class="badge bg-secondary ms-1">${state.zones.length}</span>
           <div class="ms-auto d-flex gap-2">
-            <button class="btn btn-outline-danger" id="bulk-delete-zones-btn" style="display:none"
+            <button class="btn btn-outline-danger edit-control" id="bulk-delete-zones-btn" style="display:none"
               onclick="handlers.bulkDeleteZones()">
               <i class="bi bi-trash me-1"></i>Delete Selected
             </button>
-            <button class="btn btn-primary" onclick="handlers.showZoneCreate()">
+            <button class="btn btn-primary edit-control" onclick="handlers.showZoneCreate()">
               <i class="bi bi-plus-lg me-1"></i>Add Zone
             </button>
           </div>
@@ -434,7 +510,7 @@ const views = {
             <table class="table table-hover align-middle mb-0">
               <thead class="table-light">
                 <tr>
-                  <th style="width:1%">
+                  <th class="edit-control" style="width:1%">
                     <input type="checkbox" id="select-all-zones" class="form-check-input"
                       onchange="document.querySelectorAll('.zone-select').forEach(cb=>cb.checked=this.checked);onZoneCheckboxChange()">
                   </th>
@@ -493,7 +569,7 @@ const views = {
               .join('');
             return `
           <tr>
-            <td style="width:1%">
+            <td class="edit-control" style="width:1%">
               <input type="checkbox" class="form-check-input record-select" value="${esc(rrKey)}"
                 onchange="onRecordCheckboxChange()"${rr.type === 'SOA' ? ' disabled' : ''}>
             </td>
@@ -503,12 +579,12 @@ const views = {
             <td>${content}</td>
             <td>
               <div class="btn-group btn-group-sm btn-group-actions">
-                <button class="btn btn-outline-secondary" title="Edit"
+                <button class="btn btn-outline-secondary edit-control" title="Edit"
                   onclick="handlers.showRecordEdit(${i})">
                   <i class="bi bi-pencil"></i>
                 </button>
                 ${rr.type !== 'SOA' ? `
-                <button class="btn btn-outline-danger" title="Delete"
+                <button class="btn btn-outline-danger edit-control" title="Delete"
                   onclick="handlers.deleteRecord(${i})">
                   <i class="bi bi-trash"></i>
                 </button>` : ''}
@@ -520,12 +596,12 @@ const views = {
             <i class="bi bi-inbox"></i>No records in this zone.</div></td></tr>`;
 
       const notifyBtn = (zone.kind === 'Master' || zone.kind === 'Native') ? `
-        <button class="btn btn-outline-warning" onclick="handlers.notifyCurrentZone()" title="Send NOTIFY to slaves">
+        <button class="btn btn-outline-warning edit-control" onclick="handlers.notifyCurrentZone()" title="Send NOTIFY to slaves">
           <i class="bi bi-broadcast me-1"></i>Notify Slaves
         </button>` : '';
 
       const axfrBtn = zone.kind === 'Slave' ? `
-        <button class="btn btn-outline-secondary" onclick="handlers.axfrRetrieveCurrentZone()" title="Retrieve zone from master">
+        <button class="btn btn-outline-secondary edit-control" onclick="handlers.axfrRetrieveCurrentZone()" title="Retrieve zone from master">
           <i class="bi bi-cloud-download me-1"></i>Retrieve
         </button>` : '';
 
@@ -539,17 +615,20 @@ const views = {
           <div class="ms-auto d-flex gap-2">
             ${notifyBtn}
             ${axfrBtn}
-            <button class="btn btn-outline-danger" id="bulk-delete-records-btn" style="display:none"
+            <button class="btn btn-outline-danger edit-control" id="bulk-delete-records-btn" style="display:none"
               onclick="handlers.bulkDeleteRecords()">
               <i class="bi bi-trash me-1"></i>Delete Selected
             </button>
             <button class="btn btn-outline-secondary" onclick="handlers.showZoneMetadata()" title="Zone metadata">
               <i class="bi bi-sliders me-1"></i>Metadata
             </button>
+            <button class="btn btn-outline-secondary" onclick="handlers.showZoneHistory()" title="Recorded changes">
+              <i class="bi bi-clock-history me-1"></i>History
+            </button>
             <button class="btn btn-outline-secondary" onclick="handlers.exportCurrentZone()" title="Export zone file">
               <i class="bi bi-download me-1"></i>Export
             </button>
-            <button class="btn btn-primary" onclick="handlers.showRecordCreate()">
+            <button class="btn btn-primary edit-control" onclick="handlers.showRecordCreate()">
               <i class="bi bi-plus-lg me-1"></i>Add Record
             </button>
           </div>
@@ -588,7 +667,7 @@ const views = {
             <table class="table table-hover align-middle mb-0">
               <thead class="table-light">
                 <tr>
-                  <th style="width:1%">
+                  <th class="edit-control" style="width:1%">
                     <input type="checkbox" id="select-all-records" class="form-check-input"
                       onchange="document.querySelectorAll('.record-select:not(:disabled)').forEach(cb=>cb.checked=this.checked);onRecordCheckboxChange()">
                   </th>
@@ -631,7 +710,7 @@ const views = {
             <td class="font-monospace">${esc(a.nameserver)}</td>
             <td>${esc(a.account || '—')}</td>
             <td>
-              <button class="btn btn-sm btn-outline-danger" onclick="handlers.deleteAutoprimary(${i})" title="Delete">
+              <button class="btn btn-sm btn-outline-danger edit-control" onclick="handlers.deleteAutoprimary(${i})" title="Delete">
                 <i class="bi bi-trash"></i>
               </button>
             </td>
@@ -643,7 +722,7 @@ const views = {
         <div class="page-header">
           <h2><i class="bi bi-hdd-network me-2 text-primary"></i>Autoprimaries</h2>
           <div class="ms-auto">
-            <button class="btn btn-primary" onclick="handlers.showAutoprimaryCreate()">
+            <button class="btn btn-primary edit-control" onclick="handlers.showAutoprimaryCreate()">
               <i class="bi bi-plus-lg me-1"></i>Add Autoprimary
             </button>
           </div>
@@ -1061,6 +1140,72 @@ const handlers = {
     }
   },
 
+  // === Change history ===
+  async showZoneHistory() {
+    const zone = state.currentZone;
+    const modalEl = document.getElementById('app-modal');
+    const saveBtn = document.getElementById('modal-save-btn');
+    document.getElementById('modal-title').textContent = `History – ${stripDot(zone.name)}`;
+    document.getElementById('modal-body').innerHTML = `
+      <div class="d-flex justify-content-center py-3">
+        <div class="spinner-border text-primary"></div>
+      </div>`;
+    saveBtn.style.display = 'none';
+    modalEl.addEventListener('hidden.bs.modal', () => { saveBtn.style.display = ''; }, { once: true });
+    new bootstrap.Modal(modalEl).show();
+
+    try {
+      const entries = await changeHistory.list(zone.name);
+      state.historyEntries = entries;
+      const describe = (rrsets) => (rrsets || []).map(rr =>
+        `<div class="font-monospace small">${esc(relativeName(rr.name, zone.name))} ${esc(rr.type)}: ${
+          (rr.records || []).length ? (rr.records || []).map(r => esc(r.content)).join(', ') : '<em>none</em>'}</div>`
+      ).join('');
+
+      document.getElementById('modal-body').innerHTML = entries.length ? `
+        <table class="table table-sm align-middle mb-0">
+          <thead><tr><th>Time</th><th>User</th><th>Before</th><th>After</th><th></th></tr></thead>
+          <tbody>${entries.map((e, i) => `
+            <tr>
+              <td class="text-nowrap">${esc(new Date(e.time).toLocaleString())}${e.revert_of ? '<div><span class="badge text-bg-secondary">revert</span></div>' : ''}</td>
+              <td>${esc(e.user || '—')}</td>
+              <td>${describe(e.before)}</td>
+              <td>${describe(e.after)}</td>
+              <td>
+                <button class="btn btn-sm btn-outline-warning edit-control" title="Restore the state before this change"
+                  onclick="handlers.revertChange(${i})">
+                  <i class="bi bi-arrow-counterclockwise me-1"></i>Revert
+                </button>
+              </td>
+            </tr>`).join('')}
+          </tbody>
+        </table>` : `<div class="empty-state"><i class="bi bi-inbox"></i>No recorded changes for this zone.</div>`;
+    } catch (err) {
+      document.getElementById('modal-body').innerHTML =
+        `<div class="alert alert-danger">${esc(err.message)}</div>`;
+    }
+  },
+
+  revertChange(idx) {
+    const zone = state.currentZone;
+    const entry = state.historyEntries[idx];
+    bootstrap.Modal.getInstance(document.getElementById('app-modal')).hide();
+    showConfirm(
+      'Revert Change',
+      `Restore the records changed by <strong>${esc(entry.user || 'unknown')}</strong> at ${esc(new Date(entry.time).toLocaleString())} to their previous state?`,
+      async () => {
+        ui.setLoading(true);
+        try {
+          await changeHistory.revert(zone.name, entry.id);
+          ui.showToast('Change reverted', 'success');
+          navigate('records', zone.id);
+        } catch (err) {
+          ui.showToast(`Revert failed: ${err.message}`, 'danger');
+        } finally { ui.setLoading(false); }
+      }
+    );
+  },
+
   // === Autoprimaries ===
   showAutoprimaryCreate() {
     document.getElementById('modal-title').textContent = 'Add Autoprimary';
@@ -1566,11 +1711,15 @@ async function init() {
     const cfg = await fetch('/api/config').then(r => r.json());
     state.serverId = cfg.server_id || 'localhost';
     state.uiVersion = cfg.ui_version || 'n/a';
+    state.user = cfg.user || null;
+    state.readOnly = Boolean(cfg.read_only);
+    setBackends(cfg.backends);
   } catch (e) {
     console.warn('Could not fetch server config:', e);
   }
 
   setFooterVersion('ui-version', 'ui', state.uiVersion);
+  setCurrentUser(state.user);
   setFooterVersion('pdns-version', 'pdns', 'loading...');
   void refreshPDNSVersion();
 
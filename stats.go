@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsCollector periodically fetches servers/{id}/statistics from every
+// backend and republishes the values on /metrics with the names PowerDNS
+// uses for its own Prometheus endpoint (pdns_auth_<name>).
+type statsCollector struct {
+	client   *http.Client
+	backends *backendSet
+	interval time.Duration
+	// rings publishes the ring statistics, whose keys are client addresses
+	// and queried names; /metrics needs no login, so they are opt-in.
+	rings bool
+
+	mu      sync.Mutex
+	scrapes map[string]statsScrape
+	order   []string
+}
+
+type statsScrape struct {
+	time     time.Time
+	duration time.Duration
+	err      error
+	items    []statisticItem
+}
+
+// statisticItem is one entry of the PowerDNS statistics response. Value is a
+// string for StatisticItem and a list of name/value pairs for
+// MapStatisticItem and RingStatisticItem.
+type statisticItem struct {
+	Type  string          `json:"type"`
+	Name  string          `json:"name"`
+	Size  json.Number     `json:"size"`
+	Value json.RawMessage `json:"value"`
+}
+
+type statisticEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// statsGauges are the plain statistics that can go down; everything else
+// PowerDNS reports is a counter since startup.
+var statsGauges = map[string]bool{
+	"fd-usage":             true,
+	"latency":              true,
+	"open-tcp-connections": true,
+	"qsize-q":              true,
+	"real-memory-usage":    true,
+	"security-status":      true,
+	"special-memory-usage": true,
+	"uptime":               true,
+}
+
+var metricNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func newStatsCollector(client *http.Client, backends *backendSet, interval time.Duration) *statsCollector {
+	return &statsCollector{client: client, backends: backends, interval: interval, scrapes: make(map[string]statsScrape)}
+}
+
+func (c *statsCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect scrapes all current backends. Backends removed by a reload drop out
+// of the next scrape.
+func (c *statsCollector) collect(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+
+	backends := c.backends.get()
+	scrapes := make([]statsScrape, len(backends))
+	var wg sync.WaitGroup
+	for i, cfg := range backends {
+		wg.Go(func() {
+			start := time.Now()
+			items, err := c.fetch(ctx, cfg)
+			scrapes[i] = statsScrape{time: start, duration: time.Since(start), err: err, items: items}
+			if err != nil {
+				log.Printf("failed to collect statistics from backend %q: %v", cfg.Name, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scrapes = make(map[string]statsScrape, len(backends))
+	c.order = c.order[:0]
+	for i, cfg := range backends {
+		c.scrapes[cfg.Name] = scrapes[i]
+		c.order = append(c.order, cfg.Name)
+	}
+}
+
+func (c *statsCollector) fetch(ctx context.Context, cfg pdnsConfig) ([]statisticItem, error) {
+	target := fmt.Sprintf("%s/api/v1/servers/%s/statistics?includerings=true", cfg.URL, url.PathEscape(cfg.ServerID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", cfg.Key)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		_, message := mapProxyError(err, cfg)
+		return nil, errors.New(message)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("PowerDNS API returned %s", resp.Status)
+	}
+
+	var items []statisticItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("decode statistics: %w", err)
+	}
+	return items, nil
+}
+
+// metricFamily collects the samples of one metric name across backends, as
+// the text format requires them to be grouped under a single TYPE line.
+type metricFamily struct {
+	typ     string
+	help    string
+	samples []string
+}
+
+// write renders the last scrape of every backend in the Prometheus text
+// exposition format.
+func (c *statsCollector) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	families := make(map[string]*metricFamily)
+	add := func(name, typ, help, labels string, value float64) {
+		family := families[name]
+		if family == nil {
+			family = &metricFamily{typ: typ, help: help}
+			families[name] = family
+		}
+		family.samples = append(family.samples, fmt.Sprintf("%s{%s} %s", name, labels, formatFloat(value)))
+	}
+
+	for _, backend := range c.order {
+		scrape := c.scrapes[backend]
+		labels := "backend=" + quoteLabel(backend)
+
+		up := 1.0
+		if scrape.err != nil {
+			up = 0
+		}
+		add("pdns_webui_statistics_up", "gauge", "Whether the last statistics scrape of the backend succeeded.", labels, up)
+		add("pdns_webui_statistics_scrape_duration_seconds", "gauge", "Duration of the last statistics scrape.", labels, scrape.duration.Seconds())
+		add("pdns_webui_statistics_last_scrape_timestamp_seconds", "gauge", "Time of the last statistics scrape since the Unix epoch.", labels, float64(scrape.time.Unix()))
+
+		for _, item := range scrape.items {
+			name := "pdns_auth_" + metricNameInvalid.ReplaceAllString(item.Name, "_")
+			switch item.Type {
+			case "StatisticItem":
+				var raw string
+				if json.Unmarshal(item.Value, &raw) != nil {
+					continue
+				}
+				value, err := strconv.ParseFloat(raw, 64)
+				if err != nil {
+					continue
+				}
+				typ := "counter"
+				if statsGauges[item.Name] || strings.HasSuffix(item.Name, "-size") {
+					typ = "gauge"
+				}
+				add(name, typ, "PowerDNS statistic "+item.Name+".", labels, value)
+
+			case "MapStatisticItem", "RingStatisticItem":
+				var entries []statisticEntry
+				if json.Unmarshal(item.Value, &entries) != nil {
+					continue
+				}
+				typ, help := "counter", "PowerDNS statistic "+item.Name+" by key."
+				if item.Type == "RingStatisticItem" {
+					if !c.rings {
+						continue
+					}
+					name = "pdns_auth_ring_" + metricNameInvalid.ReplaceAllString(item.Name, "_")
+					typ, help = "gauge", "PowerDNS ring "+item.Name+" (most frequent entries)."
+					if size, err := item.Size.Float64(); err == nil {
+						add(name+"_capacity", "gauge", "Capacity of the PowerDNS ring "+item.Name+".", labels, size)
+					}
+				}
+				for _, entry := range entries {
+					value, err := strconv.ParseFloat(entry.Value, 64)
+					if err != nil {
+						continue
+					}
+					add(name, typ, help, labels+",key="+quoteLabel(entry.Name), value)
+				}
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(families)) {
+		family := families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, family.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, family.typ)
+		for _, sample := range family.samples {
+			fmt.Fprintln(w, sample)
+		}
+	}
+}
+
+// quoteLabel escapes a label value for the text format. Ring keys are query
+// names sent by arbitrary clients, so they may contain any bytes.
+func quoteLabel(value string) string {
+	value = strings.ToValidUTF8(value, "�")
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
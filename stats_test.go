@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testStatistics = `[
+  {"type": "StatisticItem", "name": "udp-queries", "value": "1200"},
+  {"type": "StatisticItem", "name": "latency", "value": "42"},
+  {"type": "StatisticItem", "name": "query-cache-size", "value": "17"},
+  {"type": "MapStatisticItem", "name": "response-by-qtype", "value": [{"name": "A", "value": "800"}, {"name": "AAAA", "value": "400"}]},
+  {"type": "RingStatisticItem", "name": "queries", "size": 10000, "value": [{"name": "example.org/A", "value": "5"}, {"name": "evil\"\n\\/TXT", "value": "1"}]}
+]`
+
+// ─── statsCollector ──────────────────────────────────────────────────────────
+
+func TestStatsCollector_RepublishesStatistics(t *testing.T) {
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/servers/localhost/statistics" || r.Header.Get("X-API-Key") != "secret" {
+			t.Errorf("unexpected request %s with key %q", r.URL.Path, r.Header.Get("X-API-Key"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testStatistics))
+	}))
+	defer pdns.Close()
+
+	stats := newStatsCollector(pdns.Client(), newBackendSet([]pdnsConfig{{Name: "main", URL: pdns.URL, Key: "secret", ServerID: "localhost"}}), time.Minute)
+	stats.rings = true
+	stats.collect(context.Background())
+
+	body := collectorOutput(stats)
+	for _, want := range []string{
+		"# TYPE pdns_auth_udp_queries counter\npdns_auth_udp_queries{backend=\"main\"} 1200\n",
+		"# TYPE pdns_auth_latency gauge\npdns_auth_latency{backend=\"main\"} 42\n",
+		"# TYPE pdns_auth_query_cache_size gauge\n",
+		`pdns_auth_response_by_qtype{backend="main",key="A"} 800`,
+		`pdns_auth_response_by_qtype{backend="main",key="AAAA"} 400`,
+		"# TYPE pdns_auth_ring_queries gauge\n",
+		`pdns_auth_ring_queries{backend="main",key="example.org/A"} 5`,
+		`pdns_auth_ring_queries{backend="main",key="evil\"\n\\/TXT"} 1`,
+		`pdns_auth_ring_queries_capacity{backend="main"} 10000`,
+		`pdns_webui_statistics_up{backend="main"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("output missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestStatsCollector_OmitsRingsByDefault(t *testing.T) {
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testStatistics))
+	}))
+	defer pdns.Close()
+
+	stats := newStatsCollector(pdns.Client(), newBackendSet([]pdnsConfig{{Name: "main", URL: pdns.URL, ServerID: "localhost"}}), time.Minute)
+	stats.collect(context.Background())
+
+	body := collectorOutput(stats)
+	if strings.Contains(body, "pdns_auth_ring_") {
+		t.Errorf("ring statistics published without PDNS_STATS_RINGS\n%s", body)
+	}
+	if !strings.Contains(body, `pdns_auth_response_by_qtype{backend="main",key="A"} 800`) {
+		t.Errorf("map statistics missing\n%s", body)
+	}
+}
+
+func TestStatsCollector_GroupsFamiliesAcrossBackends(t *testing.T) {
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testStatistics))
+	}))
+	defer pdns.Close()
+
+	stats := newStatsCollector(pdns.Client(), newBackendSet([]pdnsConfig{
+		{Name: "a", URL: pdns.URL, ServerID: "localhost"},
+		{Name: "b", URL: pdns.URL, ServerID: "localhost"},
+	}), time.Minute)
+	stats.collect(context.Background())
+
+	body := collectorOutput(stats)
+	if n := strings.Count(body, "# TYPE pdns_auth_udp_queries "); n != 1 {
+		t.Errorf("TYPE line for pdns_auth_udp_queries appears %d times, want 1", n)
+	}
+	want := "pdns_auth_udp_queries{backend=\"a\"} 1200\npdns_auth_udp_queries{backend=\"b\"} 1200\n"
+	if !strings.Contains(body, want) {
+		t.Errorf("samples of both backends are not grouped\n%s", body)
+	}
+}
+
+func TestStatsCollector_FailedBackendIsDown(t *testing.T) {
+	pdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+	}))
+	defer pdns.Close()
+
+	stats := newStatsCollector(pdns.Client(), newBackendSet([]pdnsConfig{{Name: "main", URL: pdns.URL, ServerID: "localhost"}}), time.Minute)
+	stats.collect(context.Background())
+
+	body := collectorOutput(stats)
+	if !strings.Contains(body, `pdns_webui_statistics_up{backend="main"} 0`) {
+		t.Errorf("failed backend not reported down\n%s", body)
+	}
+	if strings.Contains(body, "pdns_auth_") {
+		t.Errorf("failed scrape published statistics\n%s", body)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+func collectorOutput(stats *statsCollector) string {
+	var b strings.Builder
+	stats.write(&b)
+	return b.String()
+}
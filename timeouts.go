@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultEndpointTimeouts give zone exports and AXFR retrieves of large zones
+// far more time than list calls, which should fail fast.
+var defaultEndpointTimeouts = map[string]time.Duration{
+	"export": 10 * time.Minute,
+	"axfr":   10 * time.Minute,
+}
+
+// timeoutClasses are the endpoint classes plus the slow zone operations.
+var timeoutClasses = append(slices.Clone(endpointClasses), "export", "axfr")
+
+// proxyTimeouts bound the stages of an upstream request; zero disables one.
+// Dial and TLSHandshake apply per connection, ResponseHeader per attempt and
+// Total to the whole request including retries and the response body.
+type proxyTimeouts struct {
+	Dial           time.Duration
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration
+	Total          time.Duration
+	// Endpoints replaces both ResponseHeader and Total per timeout class (see
+	// timeoutClass).
+	Endpoints map[string]time.Duration
+}
+
+func getProxyTimeouts() (proxyTimeouts, error) {
+	timeouts := proxyTimeouts{
+		Dial:           getEnvDuration("PROXY_DIAL_TIMEOUT", 5*time.Second),
+		TLSHandshake:   getEnvDuration("PROXY_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+		ResponseHeader: getEnvDuration("PROXY_RESPONSE_HEADER_TIMEOUT", 30*time.Second),
+		Total:          getEnvDuration("PROXY_TIMEOUT", 60*time.Second),
+		Endpoints:      maps.Clone(defaultEndpointTimeouts),
+	}
+	overrides, err := parseEndpointDurations(getEnv("PROXY_TIMEOUT_ENDPOINTS", ""))
+	if err != nil {
+		return proxyTimeouts{}, fmt.Errorf("PROXY_TIMEOUT_ENDPOINTS: %w", err)
+	}
+	maps.Copy(timeouts.Endpoints, overrides)
+	return timeouts, nil
+}
+
+// parseEndpointDurations parses "export=30m,zones=10s" with the timeout
+// classes as keys.
+func parseEndpointDurations(value string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, item := range splitList(value) {
+		class, timeout, ok := strings.Cut(item, "=")
+		class = strings.ToLower(strings.TrimSpace(class))
+		if !ok || !slices.Contains(timeoutClasses, class) {
+			return nil, fmt.Errorf("invalid entry %q, use <endpoint>=<duration> with endpoint one of %s", item, strings.Join(timeoutClasses, ", "))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(timeout))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration in %q", item)
+		}
+		durations[class] = d
+	}
+	return durations, nil
+}
+
+// timeoutClass refines endpointClass with "export" for zone exports and
+// "axfr" for AXFR retrieves.
+func timeoutClass(method, path string) string {
+	segments := strings.Split(path, "/")
+	if len(segments) == 5 && segments[0] == "servers" && segments[2] == "zones" {
+		switch segments[4] {
+		case "export":
+			return "export"
+		case "axfr-retrieve":
+			return "axfr"
+		}
+	}
+	return endpointClass(method, path)
+}
+
+// forClass returns the response header and total timeouts of a class.
+func (t proxyTimeouts) forClass(class string) (header, total time.Duration) {
+	if timeout, ok := t.Endpoints[class]; ok {
+		return timeout, timeout
+	}
+	return t.ResponseHeader, t.Total
+}
+
+// configure sets the connection timeouts on the upstream transport.
+func (t proxyTimeouts) configure(transport *http.Transport) {
+	dialer := &net.Dialer{Timeout: t.Dial, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = t.TLSHandshake
+}
+
+// upstreamTimeoutError tells which timeout ended an upstream request.
+type upstreamTimeoutError struct {
+	stage string // "dial", "tls", "header" or "total"
+	limit time.Duration
+	class string
+	err   error
+}
+
+func (e *upstreamTimeoutError) Error() string {
+	var what, setting string
+	switch e.stage {
+	case "dial":
+		what, setting = fmt.Sprintf("could not connect within the %s dial timeout", e.limit), "PROXY_DIAL_TIMEOUT"
+	case "tls":
+		what, setting = fmt.Sprintf("TLS handshake did not finish within the %s TLS handshake timeout", e.limit), "PROXY_TLS_HANDSHAKE_TIMEOUT"
+	case "header":
+		what, setting = fmt.Sprintf("no response within the %s response header timeout for %s requests", e.limit, e.class), "PROXY_RESPONSE_HEADER_TIMEOUT or PROXY_TIMEOUT_ENDPOINTS"
+	default:
+		what, setting = fmt.Sprintf("request did not complete within the %s total timeout for %s requests", e.limit, e.class), "PROXY_TIMEOUT or PROXY_TIMEOUT_ENDPOINTS"
+	}
+	return fmt.Sprintf("PowerDNS API request timed out: %s (%s)", what, setting)
+}
+
+func (e *upstreamTimeoutError) Unwrap() error { return e.err }
+
+// explainTimeout wraps a failed attempt in an upstreamTimeoutError naming the
+// timeout that fired. Other errors are returned unchanged.
+func (t proxyTimeouts) explainTimeout(ctx context.Context, err error) error {
+	var timeoutErr *upstreamTimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		explained := *timeoutErr
+		explained.err = err
+		return &explained
+	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return &upstreamTimeoutError{stage: "dial", limit: t.Dial, err: err}
+	}
+	// net/http does not export its TLS handshake timeout error.
+	if strings.Contains(err.Error(), "TLS handshake timeout") {
+		return &upstreamTimeoutError{stage: "tls", limit: t.TLSHandshake, err: err}
+	}
+	return err
+}
+
+// withTotalTimeout bounds the whole upstream request of a class.
+func (t proxyTimeouts) withTotalTimeout(ctx context.Context, class string) (context.Context, context.CancelFunc) {
+	_, total := t.forClass(class)
+	if total <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, total, &upstreamTimeoutError{stage: "total", limit: total, class: class})
+}
+
+// sendWithHeaderTimeout sends one attempt and cancels it if the response
+// headers do not arrive within the class's response header timeout. The
+// attempt's context lives until the response body is closed.
+func (t proxyTimeouts) sendWithHeaderTimeout(client *http.Client, req *http.Request, class string) (*http.Response, error) {
+	header, _ := t.forClass(class)
+	if header <= 0 {
+		resp, err := client.Do(req)
+		if err != nil {
+			err = t.explainTimeout(req.Context(), err)
+		}
+		return resp, err
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(header, func() {
+		cancel(&upstreamTimeoutError{stage: "header", limit: header, class: class})
+	})
+	resp, err := client.Do(req.WithContext(ctx))
+	timer.Stop()
+	if err != nil {
+		err = t.explainTimeout(ctx, err)
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
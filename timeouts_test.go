@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ─── timeoutClass ────────────────────────────────────────────────────────────
+
+func TestTimeoutClass(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "servers/localhost/zones/example.org./export", "export"},
+		{http.MethodPut, "servers/localhost/zones/example.org./axfr-retrieve", "axfr"},
+		{http.MethodGet, "servers/localhost/zones", "zones"},
+		{http.MethodGet, "servers/localhost/zones/example.org.", "zones"},
+		{http.MethodPatch, "servers/localhost/zones/example.org.", "rrsets"},
+		{http.MethodGet, "servers/localhost/statistics", "statistics"},
+	}
+	for _, tt := range tests {
+		if got := timeoutClass(tt.method, tt.path); got != tt.want {
+			t.Errorf("timeoutClass(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// ─── getProxyTimeouts ────────────────────────────────────────────────────────
+
+func TestGetProxyTimeouts_DefaultsAndOverrides(t *testing.T) {
+	unsetEnv(t, "PROXY_DIAL_TIMEOUT", "PROXY_TLS_HANDSHAKE_TIMEOUT", "PROXY_RESPONSE_HEADER_TIMEOUT")
+	t.Setenv("PROXY_TIMEOUT", "45s")
+	t.Setenv("PROXY_TIMEOUT_ENDPOINTS", "zones=10s, export=30m")
+
+	timeouts, err := getProxyTimeouts()
+	if err != nil {
+		t.Fatalf("getProxyTimeouts: %v", err)
+	}
+	if timeouts.Dial != 5*time.Second || timeouts.TLSHandshake != 10*time.Second || timeouts.ResponseHeader != 30*time.Second {
+		t.Errorf("connection timeouts = %+v", timeouts)
+	}
+	for class, want := range map[string][2]time.Duration{
+		"servers": {30 * time.Second, 45 * time.Second},
+		"zones":   {10 * time.Second, 10 * time.Second},
+		"export":  {30 * time.Minute, 30 * time.Minute},
+		"axfr":    {10 * time.Minute, 10 * time.Minute},
+	} {
+		if header, total := timeouts.forClass(class); header != want[0] || total != want[1] {
+			t.Errorf("forClass(%q) = %s, %s, want %s, %s", class, header, total, want[0], want[1])
+		}
+	}
+}
+
+func TestParseEndpointDurations_RejectsInvalidEntries(t *testing.T) {
+	for _, value := range []string{"exports=1m", "zones", "zones=soon", "zones=-1s"} {
+		if _, err := parseEndpointDurations(value); err == nil {
+			t.Errorf("parseEndpointDurations(%q) succeeded, want error", value)
+		}
+	}
+}
+
+// ─── pdnsProxy timeouts ──────────────────────────────────────────────────────
+
+func TestPDNSProxy_ResponseHeaderTimeout_NamedInDetail(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/export") {
+			time.Sleep(100 * time.Millisecond)
+			writeJSON(w, http.StatusOK, "example.org.\t3600\tIN\tSOA\t...")
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	proxy.timeouts = proxyTimeouts{
+		ResponseHeader: 50 * time.Millisecond,
+		Total:          5 * time.Second,
+		Endpoints:      map[string]time.Duration{"export": 5 * time.Second},
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	if detail := decodeDetail(t, w); !strings.Contains(detail, "50ms response header timeout for zones requests") {
+		t.Errorf("detail = %q", detail)
+	}
+
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/zones/example.org./export", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("export status = %d, want 200 within its own timeout: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPDNSProxy_TotalTimeout_NamedInDetail(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+	proxy.timeouts = proxyTimeouts{Total: 50 * time.Millisecond}
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost/statistics", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	if detail := decodeDetail(t, w); !strings.Contains(detail, "50ms total timeout for statistics requests") {
+		t.Errorf("detail = %q", detail)
+	}
+}
+
+func TestPDNSProxy_TLSHandshakeTimeout_NamedInDetail(t *testing.T) {
+	// A listener that accepts connections but never answers the handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	timeouts := proxyTimeouts{Dial: time.Second, TLSHandshake: 50 * time.Millisecond, Total: 5 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	timeouts.configure(transport)
+	proxy := newTestProxy("https://" + ln.Addr().String())
+	proxy.timeouts = timeouts
+	proxy.client = &http.Client{Transport: transport}
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/pdns/servers/localhost", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	if detail := decodeDetail(t, w); !strings.Contains(detail, "50ms TLS handshake timeout") {
+		t.Errorf("detail = %q", detail)
+	}
+}
+
+func TestExplainTimeout_Dial(t *testing.T) {
+	timeouts := proxyTimeouts{Dial: 3 * time.Second}
+	err := timeouts.explainTimeout(t.Context(), &net.OpError{Op: "dial", Net: "tcp", Err: fakeTimeoutError{}})
+
+	status, message := mapProxyError(err, pdnsConfig{})
+	if status != http.StatusGatewayTimeout || !strings.Contains(message, "3s dial timeout") {
+		t.Errorf("mapProxyError = %d %q", status, message)
+	}
+}
+
+// ─── helpers ─────────────────────────────────────────────────────────────────
+
+func decodeDetail(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return body["detail"]
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const certCheckInterval = 5 * time.Second
+
+type tlsConfig struct {
+	CertFile     string
+	KeyFile      string
+	MinVersion   string
+	CipherSuites []string
+	RedirectAddr string
+	// RedirectHost is the public host[:port] plain HTTP is redirected to.
+	RedirectHost string
+	ClientCAFile string
+	ClientAuth   string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func getTLSConfig() tlsConfig {
+	return tlsConfig{
+		CertFile:     getEnv("TLS_CERT_FILE", ""),
+		KeyFile:      getEnv("TLS_KEY_FILE", ""),
+		MinVersion:   getEnv("TLS_MIN_VERSION", "1.2"),
+		CipherSuites: splitList(getEnv("TLS_CIPHER_SUITES", "")),
+		RedirectAddr: getEnv("TLS_REDIRECT_ADDR", ""),
+		RedirectHost: getEnv("TLS_REDIRECT_HOST", ""),
+		ClientCAFile: getEnv("TLS_CLIENT_CA_FILE", ""),
+		ClientAuth:   getEnv("TLS_CLIENT_AUTH", "require"),
+	}
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// serverConfig validates the settings and returns a tls.Config that picks up
+// renewed certificates from disk without a restart.
+func (c tlsConfig) serverConfig() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("certificate and key file must be set together")
+	}
+
+	minVersion, err := parseTLSVersion(c.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := parseCipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := newCertReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if c.ClientCAFile != "" {
+		if cfg.ClientAuth, err = parseClientAuth(c.ClientAuth); err != nil {
+			return nil, err
+		}
+		if cfg.ClientCAs, err = loadCertPool(c.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseTLSVersion(value string) (uint16, error) {
+	if value == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[value]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, use 1.0, 1.1, 1.2 or 1.3", value)
+	}
+	return version, nil
+}
+
+// parseCipherSuites maps IANA names such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+// to suite IDs. Only suites Go considers secure are accepted; TLS 1.3 suites
+// are not configurable and always enabled.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// certReloader serves a key pair and reloads it when either file's
+// modification time changes. A broken pair on disk keeps the previous one.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTimes  [2]time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: certCheckInterval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *certReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) >= r.interval {
+		r.lastCheck = time.Now()
+		if modTimes, err := r.stat(); err == nil && modTimes != r.modTimes {
+			if err := r.load(); err != nil {
+				log.Printf("failed to reload TLS certificate, keeping the previous one: %v", err)
+			} else {
+				log.Printf("reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to publicHost, or else to the
+// requested host if the certificate is valid for it, on httpsPort. A public
+// host with a port is used as is.
+func redirectToHTTPS(httpsPort, publicHost string, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := publicHost
+		if host == "" {
+			host = r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			// The Host header is chosen by the client; without this check the
+			// listener redirects to any site it names.
+			if !certificateCovers(getCertificate, host) {
+				writeError(w, http.StatusBadRequest, "unknown host")
+				return
+			}
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			if httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			} else if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// certificateCovers reports whether the served certificate is valid for host.
+func certificateCovers(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), host string) bool {
+	cert, err := getCertificate(&tls.ClientHelloInfo{ServerName: host})
+	if err != nil || cert == nil || len(cert.Certificate) == 0 {
+		return false
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return false
+		}
+	}
+	return leaf.VerifyHostname(host) == nil
+}
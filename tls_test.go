@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ─── certReloader ────────────────────────────────────────────────────────────
+
+func TestCertReloader_PicksUpRenewedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestKeyPair(t, certFile, keyFile, "old.example.com")
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	certs.interval = 0
+
+	writeTestKeyPair(t, certFile, keyFile, "new.example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	if got := leafName(t, certs); got != "new.example.com" {
+		t.Errorf("certificate CN = %q after renewal, want %q", got, "new.example.com")
+	}
+}
+
+func TestCertReloader_BrokenFileKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestKeyPair(t, certFile, keyFile, "old.example.com")
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	certs.interval = 0
+
+	writeFile(t, certFile, "not a certificate")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	if got := leafName(t, certs); got != "old.example.com" {
+		t.Errorf("certificate CN = %q, want previous %q", got, "old.example.com")
+	}
+}
+
+// ─── tlsConfig.serverConfig ──────────────────────────────────────────────────
+
+func TestTLSConfig_ServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestKeyPair(t, certFile, keyFile, "localhost")
+
+	cfg, err := tlsConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}.serverConfig()
+	if err != nil {
+		t.Fatalf("serverConfig: %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 || len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+func TestTLSConfig_ServerConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestKeyPair(t, certFile, keyFile, "localhost")
+
+	for name, cfg := range map[string]tlsConfig{
+		"missing key":     {CertFile: certFile},
+		"bad version":     {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.4"},
+		"insecure cipher": {CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"missing file":    {CertFile: filepath.Join(dir, "nope.crt"), KeyFile: keyFile},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := cfg.serverConfig(); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// ─── redirectToHTTPS ─────────────────────────────────────────────────────────
+
+func TestRedirectToHTTPS(t *testing.T) {
+	certs := newTestCertReloader(t, "dns.example.com")
+	for port, want := range map[string]string{
+		"443":  "https://dns.example.com/zones?x=1",
+		"8443": "https://dns.example.com:8443/zones?x=1",
+	} {
+		t.Run(port, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://dns.example.com:80/zones?x=1", nil)
+			w := httptest.NewRecorder()
+			redirectToHTTPS(port, "", certs.GetCertificate).ServeHTTP(w, req)
+
+			if w.Code != http.StatusPermanentRedirect {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusPermanentRedirect)
+			}
+			if got := w.Header().Get("Location"); got != want {
+				t.Errorf("Location = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRedirectToHTTPS_UntrustedHost(t *testing.T) {
+	certs := newTestCertReloader(t, "dns.example.com")
+	req := httptest.NewRequest(http.MethodGet, "http://evil.example/login", nil)
+
+	w := httptest.NewRecorder()
+	redirectToHTTPS("443", "", certs.GetCertificate).ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+		t.Errorf("response = %d %q, want 400 for a host the certificate does not cover", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	redirectToHTTPS("8443", "dns.example.com", certs.GetCertificate).ServeHTTP(w, req)
+	if got := w.Header().Get("Location"); got != "https://dns.example.com:8443/login" {
+		t.Errorf("Location = %q, want the configured public host", got)
+	}
+}
+
+// ─── parseListenConfig с TLS ─────────────────────────────────────────────────
+
+func TestParseListenConfig_TLSFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/env/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/env/tls.key")
+	t.Setenv("TLS_MIN_VERSION", "1.3")
+
+	cfg, err := parseListenConfig([]string{"-tls-cert", "/flag/tls.crt"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseListenConfig: %v", err)
+	}
+	if cfg.TLS.CertFile != "/flag/tls.crt" || cfg.TLS.KeyFile != "/env/tls.key" || cfg.TLS.MinVersion != "1.3" {
+		t.Errorf("TLS = %+v", cfg.TLS)
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func writeTestKeyPair(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+}
+
+func newTestCertReloader(t *testing.T, commonName string) *certReloader {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestKeyPair(t, certFile, keyFile, commonName)
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	return certs
+}
+
+func leafName(t *testing.T, certs *certReloader) string {
+	t.Helper()
+	cert, err := certs.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// upstreamTLSConfig controls how the proxy verifies and authenticates to the
+// PowerDNS API. The settings apply to every backend.
+type upstreamTLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+func getUpstreamTLSConfig() upstreamTLSConfig {
+	return upstreamTLSConfig{
+		CAFile:             getEnv("PDNS_TLS_CA_FILE", ""),
+		CertFile:           getEnv("PDNS_TLS_CERT_FILE", ""),
+		KeyFile:            getEnv("PDNS_TLS_KEY_FILE", ""),
+		ServerName:         getEnv("PDNS_TLS_SERVER_NAME", ""),
+		InsecureSkipVerify: getEnvBool("PDNS_TLS_INSECURE_SKIP_VERIFY", false),
+	}
+}
+
+func (c upstreamTLSConfig) clientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		// Keep the system roots so public certificates still verify.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("client certificate and key file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// newUpstreamTransport returns a copy of the default transport that uses the
+// upstream TLS settings.
+func newUpstreamTransport(c upstreamTLSConfig) (*http.Transport, error) {
+	tlsCfg, err := c.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.InsecureSkipVerify {
+		log.Printf("WARNING: TLS certificate verification of the PowerDNS API is DISABLED (PDNS_TLS_INSECURE_SKIP_VERIFY); API keys can be intercepted, use PDNS_TLS_CA_FILE instead")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return transport, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// ─── newUpstreamTransport ────────────────────────────────────────────────────
+
+func TestUpstreamTransport_PrivateCAAndClientCertificate(t *testing.T) {
+	clientCA := newTestCA(t, "Upstream clients")
+	backend := newUpstreamTLSServer(t, clientCA)
+
+	dir := t.TempDir()
+	caFile := writeServerCA(t, backend, dir)
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeIssuedKeyPair(t, clientCA, certFile, keyFile, "pdns-webui")
+
+	client := newUpstreamClient(t, upstreamTLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	// Without the client certificate the upstream rejects the handshake.
+	client = newUpstreamClient(t, upstreamTLSConfig{CAFile: caFile})
+	if _, err := client.Get(backend.URL); err == nil {
+		t.Error("expected handshake failure without client certificate")
+	}
+}
+
+func TestUpstreamTransport_ServerNameOverride(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	caFile := writeServerCA(t, backend, t.TempDir())
+
+	// The httptest certificate is valid for example.com and 127.0.0.1.
+	if _, err := newUpstreamClient(t, upstreamTLSConfig{CAFile: caFile, ServerName: "example.com"}).Get(backend.URL); err != nil {
+		t.Errorf("GET with matching SNI: %v", err)
+	}
+	if _, err := newUpstreamClient(t, upstreamTLSConfig{CAFile: caFile, ServerName: "pdns.internal"}).Get(backend.URL); err == nil {
+		t.Error("expected verification failure for a name not in the certificate")
+	}
+}
+
+func TestUpstreamTransport_InsecureSkipVerify(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	if _, err := newUpstreamClient(t, upstreamTLSConfig{}).Get(backend.URL); err == nil {
+		t.Error("untrusted certificate must fail by default")
+	}
+	if _, err := newUpstreamClient(t, upstreamTLSConfig{InsecureSkipVerify: true}).Get(backend.URL); err != nil {
+		t.Errorf("GET with verification disabled: %v", err)
+	}
+}
+
+func TestUpstreamTransport_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.crt")
+	writeFile(t, notPEM, "not a certificate")
+
+	for name, cfg := range map[string]upstreamTLSConfig{
+		"missing CA":   {CAFile: filepath.Join(dir, "missing.crt")},
+		"CA not PEM":   {CAFile: notPEM},
+		"cert w/o key": {CertFile: notPEM},
+		"bad pair":     {CertFile: notPEM, KeyFile: notPEM},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newUpstreamTransport(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func newUpstreamClient(t *testing.T, cfg upstreamTLSConfig) *http.Client {
+	t.Helper()
+	transport, err := newUpstreamTransport(cfg)
+	if err != nil {
+		t.Fatalf("newUpstreamTransport: %v", err)
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport}
+}
+
+// newUpstreamTLSServer requires client certificates issued by clientCA.
+func newUpstreamTLSServer(t *testing.T, clientCA *testCA) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	pool := newCertPool(t, clientCA)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeServerCA(t *testing.T, server *httptest.Server, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "upstream-ca.crt")
+	writeFile(t, path, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	return path
+}
+
+func writeIssuedKeyPair(t *testing.T, ca *testCA, certFile, keyFile, commonName string) {
+	t.Helper()
+	cert := ca.issue(t, commonName)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})))
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})))
+}
+
+func newCertPool(t *testing.T, ca *testCA) *x509.CertPool {
+	t.Helper()
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca.pem) {
+		t.Fatal("append CA certificate to pool")
+	}
+	return pool
+}